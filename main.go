@@ -2,14 +2,18 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/Financial-Times/base-ft-rw-app-go/baseftrwapp"
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
+	"github.com/Financial-Times/http-handlers-go/httphandlers"
 	"github.com/Financial-Times/neo-utils-go/neoutils"
 	"github.com/Financial-Times/organisations-rw-neo4j/organisations"
+	"github.com/gorilla/mux"
 	"github.com/jawher/mow.cli"
+	metrics "github.com/rcrowley/go-metrics"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -45,6 +49,54 @@ func main() {
 		Desc:   "Maximum number of statements to execute per batch",
 		EnvVar: "BATCH_SIZE",
 	})
+	foldSourceNames := app.Bool(cli.BoolOpt{
+		Name:   "foldSourceNames",
+		Value:  false,
+		Desc:   "Whether to keep the names of organisations concorded away as former names and aliases of the canonical organisation",
+		EnvVar: "FOLD_SOURCE_NAMES",
+	})
+	transferRelationships := app.Strings(cli.StringsOpt{
+		Name:   "transferRelationships",
+		Value:  []string{},
+		Desc:   "Relationship types moved from an organisation being concorded. All types not dropped or blocking are moved if none are given",
+		EnvVar: "TRANSFER_RELATIONSHIPS",
+	})
+	dropRelationships := app.Strings(cli.StringsOpt{
+		Name:   "dropRelationships",
+		Value:  []string{},
+		Desc:   "Relationship types deleted with an organisation being concorded, rather than moved",
+		EnvVar: "DROP_RELATIONSHIPS",
+	})
+	blockRelationships := app.Strings(cli.StringsOpt{
+		Name:   "blockRelationships",
+		Value:  []string{},
+		Desc:   "Relationship types which make a write fail rather than concord the organisation having them",
+		EnvVar: "BLOCK_RELATIONSHIPS",
+	})
+	repointLoopRelationships := app.Strings(cli.StringsOpt{
+		Name:   "repointLoopRelationships",
+		Value:  []string{},
+		Desc:   "Relationship types between an organisation being concorded and the canonical organisation which are kept as a relationship of the canonical organisation with itself, rather than dropped",
+		EnvVar: "REPOINT_LOOP_RELATIONSHIPS",
+	})
+	writeRetries := app.Int(cli.IntOpt{
+		Name:   "writeRetries",
+		Value:  3,
+		Desc:   "How many times a write failing with a transient neo4j error, such as a deadlock, is retried",
+		EnvVar: "WRITE_RETRIES",
+	})
+	writeRetryBackoff := app.Int(cli.IntOpt{
+		Name:   "writeRetryBackoff",
+		Value:  100,
+		Desc:   "Milliseconds to wait before the first retry of a write, doubling with every further retry",
+		EnvVar: "WRITE_RETRY_BACKOFF",
+	})
+	orgTypesFile := app.String(cli.StringOpt{
+		Name:   "orgTypesFile",
+		Value:  "",
+		Desc:   "JSON file mapping organisation types supported besides Organisation, Company and PublicCompany to their labels, from their own up to Thing",
+		EnvVar: "ORG_TYPES_FILE",
+	})
 	logMetrics := app.Bool(cli.BoolOpt{
 		Name:   "logMetrics",
 		Value:  false,
@@ -64,7 +116,29 @@ func main() {
 		if err != nil {
 			log.Errorf("Could not connect to neo4j, error=[%s]\n", err)
 		}
-		organisationsDriver := organisations.NewCypherOrganisationService(db)
+		// the write locks are claimed in transactions of their own, which batching would merge with other writes
+		lockConf := neoutils.DefaultConnectionConfig()
+		lockConf.BatchSize = 0
+		lockDB, err := neoutils.Connect(*neoURL, lockConf)
+		if err != nil {
+			log.Errorf("Could not connect to neo4j for write locks, error=[%s]\n", err)
+		}
+		orgTypes, err := loadOrgTypes(*orgTypesFile)
+		if err != nil {
+			log.Fatalf("Could not load the organisation types, error=[%s]\n", err)
+		}
+		organisationsDriver := organisations.NewCypherOrganisationService(db, organisations.Config{
+			BatchSize:                  *batchSize,
+			FoldSourceNames:            *foldSourceNames,
+			TransferredRelationships:   *transferRelationships,
+			DroppedRelationships:       *dropRelationships,
+			BlockingRelationships:      *blockRelationships,
+			RepointedLoopRelationships: *repointLoopRelationships,
+			WriteRetries:               *writeRetries,
+			WriteRetryBackoff:          time.Duration(*writeRetryBackoff) * time.Millisecond,
+			OrgTypes:                   orgTypes,
+			LockRunner:                 lockDB,
+		})
 		organisationsDriver.Initialise()
 
 		baseftrwapp.OutputMetricsIfRequired(*graphiteTCPAddress, *graphitePrefix, *logMetrics)
@@ -88,6 +162,8 @@ func main() {
 			Timeout: 10 * time.Second,
 		}
 
+		registerOrganisationHandlers(organisations.NewHandler(organisationsDriver))
+
 		healthHandler := fthealth.Handler(timedHC)
 		baseftrwapp.RunServerWithConf(baseftrwapp.RWConf{
 			Services:      services,
@@ -104,6 +180,32 @@ func main() {
 	app.Run(os.Args)
 }
 
+// loadOrgTypes reads the organisation types from the file, if one is given
+func loadOrgTypes(path string) (organisations.OrgTypes, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return organisations.LoadOrgTypes(f)
+}
+
+// registerOrganisationHandlers mounts the organisation endpoints with the same request logging and metrics as baseftrwapp.
+// They shadow the /organisations routes baseftrwapp registers under "/", which keeps serving the admin endpoints
+func registerOrganisationHandlers(handler organisations.Handler) {
+	router := mux.NewRouter()
+	handler.RegisterHandlers(router)
+
+	var h http.Handler = httphandlers.TransactionAwareRequestLoggingHandler(log.StandardLogger(), router)
+	h = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, h)
+
+	http.Handle("/organisations", h)
+	http.Handle("/organisations/", h)
+}
+
 func makeCheck(service baseftrwapp.Service, cr neoutils.CypherRunner) fthealth.Check {
 	return fthealth.Check{
 		BusinessImpact:   "Cannot read/write organisations via this writer",
@@ -0,0 +1,143 @@
+package organisations
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Financial-Times/organisations-rw-neo4j/transfer"
+	"github.com/jmcvetta/neoism"
+)
+
+const (
+	outgoingDirection = transfer.Outgoing
+	incomingDirection = transfer.Incoming
+)
+
+// movedRelationshipsOf counts the relationships a merge moves from the old node, leaving out those deleted before the transfer
+// by constructDeleteEntityRelationshipQuery
+func movedRelationshipsOf(relationshipsFromNode relationships, relationshipsToNode relationships) []movedRelationships {
+	moved := []movedRelationships{}
+	for _, rel := range relationshipsFromNode {
+		if isEntityRelationship(rel.RelationshipType, outgoingDirection) {
+			continue
+		}
+		moved = append(moved, movedRelationships{Type: rel.RelationshipType, Direction: outgoingDirection, Count: rel.Count})
+	}
+	for _, rel := range relationshipsToNode {
+		if isEntityRelationship(rel.RelationshipType, incomingDirection) {
+			continue
+		}
+		moved = append(moved, movedRelationships{Type: rel.RelationshipType, Direction: incomingDirection, Count: rel.Count})
+	}
+	return moved
+}
+
+// isEntityRelationship tells whether relationships of the type, in the direction they point from an organisation,
+// are deleted by constructDeleteEntityRelationshipQuery
+func isEntityRelationship(relationshipType string, direction string) bool {
+	if direction == outgoingDirection {
+		return relationshipType == "HAS_CLASSIFICATION" || relationshipType == "SUB_ORGANISATION_OF"
+	}
+	return relationshipType == "IDENTIFIES"
+}
+
+// constructConcordanceAuditQuery records the merge of the source node into the canonical one, along with the source
+// organisation as it was before the merge, if the node was one, and the properties lost by relationships collapsing.
+// Neo4j cannot store maps as properties, so these are stored as JSON
+func constructConcordanceAuditQuery(canonicalUUID string, transId string, merge plannedMerge) (*neoism.CypherQuery, error) {
+	movedJSON, err := json.Marshal(merge.Relationships)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceJSON := ""
+	if merge.Source != nil {
+		b, err := json.Marshal(merge.Source)
+		if err != nil {
+			return nil, err
+		}
+		sourceJSON = string(b)
+	}
+
+	collapsed := merge.Collapsed
+	if collapsed == nil {
+		collapsed = []transfer.Collapse{}
+	}
+	collapsedJSON, err := json.Marshal(collapsed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &neoism.CypherQuery{
+		Statement: `CREATE (:ConcordanceAudit {canonicalUUID: {canonicalUUID}, sourceUUID: {sourceUUID},
+					transactionId: {transId}, timestamp: timestamp(), relationships: {relationships}, source: {source},
+					collapsed: {collapsed}})`,
+		Parameters: map[string]interface{}{
+			"canonicalUUID": canonicalUUID,
+			"sourceUUID":    merge.SourceUUID,
+			"transId":       transId,
+			"relationships": string(movedJSON),
+			"source":        sourceJSON,
+			"collapsed":     string(collapsedJSON),
+		},
+	}, nil
+}
+
+//ConcordanceAudits - Returns the records of the merges the uuid took part in, as canonical or as source uuid, oldest first
+func (cd service) ConcordanceAudits(uuid string, transId string) ([]concordanceAudit, error) {
+	results := []struct {
+		CanonicalUUID string `json:"canonicalUUID"`
+		SourceUUID    string `json:"sourceUUID"`
+		TransactionID string `json:"transactionId"`
+		Timestamp     int64  `json:"timestamp"`
+		Relationships string `json:"relationships"`
+		Source        string `json:"source"`
+		Collapsed     string `json:"collapsed"`
+	}{}
+
+	readQuery := &neoism.CypherQuery{
+		Statement: `MATCH (a:ConcordanceAudit)
+					WHERE a.canonicalUUID = {uuid} OR a.sourceUUID = {uuid}
+					RETURN a.canonicalUUID as canonicalUUID, a.sourceUUID as sourceUUID, a.transactionId as transactionId,
+						a.timestamp as timestamp, a.relationships as relationships, a.source as source, a.collapsed as collapsed
+					ORDER BY timestamp`,
+		Parameters: map[string]interface{}{
+			"uuid": uuid,
+		},
+		Result: &results,
+	}
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{readQuery}); err != nil {
+		return nil, err
+	}
+
+	audits := []concordanceAudit{}
+	for _, result := range results {
+		audit := concordanceAudit{
+			CanonicalUUID: result.CanonicalUUID,
+			SourceUUID:    result.SourceUUID,
+			TransactionID: result.TransactionID,
+			Timestamp:     time.Unix(0, result.Timestamp*int64(time.Millisecond)).UTC(),
+			Relationships: []movedRelationships{},
+			Collapsed:     []transfer.Collapse{},
+		}
+		if err := json.Unmarshal([]byte(result.Relationships), &audit.Relationships); err != nil {
+			return nil, err
+		}
+		// audits recorded before collapses were tracked have none
+		if result.Collapsed != "" {
+			if err := json.Unmarshal([]byte(result.Collapsed), &audit.Collapsed); err != nil {
+				return nil, err
+			}
+		}
+		if result.Source != "" {
+			audit.Source = &organisation{}
+			if err := json.Unmarshal([]byte(result.Source), audit.Source); err != nil {
+				return nil, err
+			}
+		}
+		audits = append(audits, audit)
+	}
+
+	return audits, nil
+}
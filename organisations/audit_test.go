@@ -0,0 +1,28 @@
+package organisations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMovedRelationshipsLeaveOutDeletedEntityRelationships(t *testing.T) {
+	assert := assert.New(t)
+
+	relationshipsFromNode := relationships{
+		{RelationshipType: "SUB_ORGANISATION_OF", Count: 1},
+		{RelationshipType: "HAS_CLASSIFICATION", Count: 1},
+		{RelationshipType: "HAS_ROLE", Count: 2},
+	}
+	relationshipsToNode := relationships{
+		{RelationshipType: "IDENTIFIES", Count: 3},
+		{RelationshipType: "MENTIONS", Count: 7},
+		{RelationshipType: "SUB_ORGANISATION_OF", Count: 2},
+	}
+
+	assert.Equal([]movedRelationships{
+		{Type: "HAS_ROLE", Direction: outgoingDirection, Count: 2},
+		{Type: "MENTIONS", Direction: incomingDirection, Count: 7},
+		{Type: "SUB_ORGANISATION_OF", Direction: incomingDirection, Count: 2},
+	}, movedRelationshipsOf(relationshipsFromNode, relationshipsToNode))
+}
@@ -0,0 +1,256 @@
+package organisations
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Financial-Times/up-rw-app-api-go/rwapi"
+	"github.com/jmcvetta/neoism"
+)
+
+const (
+	bulkWritten  = "written"
+	bulkSkipped  = "skipped"
+	bulkRejected = "rejected"
+
+	maxBulkLineSize = 1024 * 1024
+)
+
+// bulkLineResult reports what happened to one line of a bulk write
+type bulkLineResult struct {
+	Line   int          `json:"line"`
+	UUID   string       `json:"uuid,omitempty"`
+	Status string       `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+	DryRun *writeDryRun `json:"dryRun,omitempty"`
+}
+
+// bulkReport reports what happened to every line of a bulk write
+type bulkReport struct {
+	Written  int              `json:"written"`
+	Skipped  int              `json:"skipped"`
+	Rejected int              `json:"rejected"`
+	Results  []bulkLineResult `json:"results"`
+}
+
+func (r *bulkReport) add(result bulkLineResult) {
+	switch result.Status {
+	case bulkWritten:
+		r.Written++
+	case bulkSkipped:
+		r.Skipped++
+	case bulkRejected:
+		r.Rejected++
+	}
+	r.Results = append(r.Results, result)
+}
+
+type pendingBulkWrite struct {
+	line    int
+	uuid    string
+	queries []*neoism.CypherQuery
+	lock    *writeLock
+}
+
+// bulkWriter groups the writes of many organisations into transactions of up to batchSize statements
+type bulkWriter struct {
+	cd      service
+	report  *bulkReport
+	pending []pendingBulkWrite
+	size    int
+	uuids   map[string]bool
+	transId string
+}
+
+// WriteBulk - Writes newline-delimited organisations, running the writes in transactions of up to the configured batch size.
+// Lines which cannot be decoded, validated or written are rejected without affecting the others, as are lines
+// claiming a uuid another write holds, which can be retried.
+// On any other error the lines already reported have been written.
+// A dry run reports what would happen to each line, planned against the stored organisations, without writing any
+func (cd service) WriteBulk(r io.Reader, opts writeOptions, transId string) (bulkReport, error) {
+	report := bulkReport{Results: []bulkLineResult{}}
+	w := &bulkWriter{cd: cd, report: &report, uuids: map[string]bool{}, transId: transId}
+
+	err := w.write(r, opts)
+	// the locks of writes left pending by an error
+	w.unlock()
+
+	sort.Slice(report.Results, func(i, j int) bool {
+		return report.Results[i].Line < report.Results[j].Line
+	})
+	return report, err
+}
+
+func (w *bulkWriter) write(r io.Reader, opts writeOptions) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxBulkLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		thing, uuid, err := w.cd.DecodeJSON(json.NewDecoder(bytes.NewReader(scanner.Bytes())))
+		if re, ok := err.(requestError); ok {
+			w.report.add(bulkLineResult{Line: line, UUID: uuid, Status: bulkRejected, Reason: re.InvalidRequestDetails()})
+			continue
+		}
+		if err != nil {
+			w.report.add(bulkLineResult{Line: line, UUID: uuid, Status: bulkRejected, Reason: err.Error()})
+			continue
+		}
+		o := thing.(organisation)
+
+		// the plan reads the graph, so it must not depend on writes which are still pending
+		if w.touches(o) {
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+
+		// the uuids stay locked until the write is flushed
+		var state writeState
+		var lock *writeLock
+		if opts.DryRun {
+			state, err = w.cd.readWriteState(o)
+		} else {
+			state, lock, err = w.cd.lockWrite(o, opts)
+		}
+		if ce, ok := err.(concurrentWriteError); ok {
+			w.report.add(bulkLineResult{Line: line, UUID: uuid, Status: bulkRejected, Reason: ce.ConcurrentWriteDetails()})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		plan, err := w.cd.planWrite(o, opts, state, w.transId)
+		if re, ok := err.(requestError); ok {
+			w.cd.unlock(lock)
+			w.report.add(bulkLineResult{Line: line, UUID: uuid, Status: bulkRejected, Reason: re.InvalidRequestDetails()})
+			continue
+		}
+		// such as a concordance blocked by the relationships of an old node
+		if ce, ok := err.(rwapi.ConstraintOrTransactionError); ok {
+			w.cd.unlock(lock)
+			w.report.add(bulkLineResult{Line: line, UUID: uuid, Status: bulkRejected, Reason: ce.Error()})
+			continue
+		}
+		if err != nil {
+			w.cd.unlock(lock)
+			return err
+		}
+
+		if opts.DryRun {
+			result, err := w.cd.describePlan(o, plan, w.transId)
+			if err != nil {
+				return err
+			}
+			status := bulkWritten
+			if !result.Changed {
+				status = bulkSkipped
+			}
+			w.report.add(bulkLineResult{Line: line, UUID: uuid, Status: status, DryRun: result.DryRun})
+			continue
+		}
+
+		if len(plan.Queries) == 0 {
+			w.cd.unlock(lock)
+			w.report.add(bulkLineResult{Line: line, UUID: uuid, Status: bulkSkipped})
+			continue
+		}
+
+		if len(w.pending) > 0 && w.size+len(plan.Queries) > w.cd.config.BatchSize {
+			if err := w.flush(); err != nil {
+				w.cd.unlock(lock)
+				return err
+			}
+		}
+		w.add(pendingBulkWrite{line: line, uuid: uuid, queries: plan.Queries, lock: lock}, o)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return requestError{fmt.Sprintf("Failed to read line %d: %s", line+1, err.Error())}
+	}
+
+	return w.flush()
+}
+
+// touches tells whether the organisation shares a uuid, including its parent's, with a pending write
+func (w *bulkWriter) touches(o organisation) bool {
+	for _, uuid := range writeUUIDs(o) {
+		if w.uuids[uuid] {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *bulkWriter) add(write pendingBulkWrite, o organisation) {
+	w.pending = append(w.pending, write)
+	w.size += len(write.queries)
+	for _, uuid := range writeUUIDs(o) {
+		w.uuids[uuid] = true
+	}
+}
+
+func bulkWriteUUIDs(o organisation) []string {
+	uuids := append([]string{o.UUID}, o.AlternativeIdentifiers.UUIDS...)
+	if o.ParentOrganisation != "" {
+		uuids = append(uuids, o.ParentOrganisation)
+	}
+	return uuids
+}
+
+// flush writes the pending organisations in one transaction. If that fails on a constraint,
+// they are written one by one so only the offending ones are rejected
+func (w *bulkWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	queries := []*neoism.CypherQuery{}
+	for _, write := range w.pending {
+		queries = append(queries, write.queries...)
+	}
+
+	err := w.cd.writeBatch(queries)
+	if err == nil {
+		for _, write := range w.pending {
+			w.report.add(bulkLineResult{Line: write.line, UUID: write.uuid, Status: bulkWritten})
+		}
+	} else if _, ok := err.(rwapi.ConstraintOrTransactionError); ok {
+		for _, write := range w.pending {
+			if err := w.cd.writeBatch(write.queries); err != nil {
+				if _, ok := err.(rwapi.ConstraintOrTransactionError); !ok {
+					return err
+				}
+				w.report.add(bulkLineResult{Line: write.line, UUID: write.uuid, Status: bulkRejected, Reason: err.Error()})
+				continue
+			}
+			w.report.add(bulkLineResult{Line: write.line, UUID: write.uuid, Status: bulkWritten})
+		}
+	} else {
+		return err
+	}
+
+	w.unlock()
+	w.pending = nil
+	w.size = 0
+	w.uuids = map[string]bool{}
+	return nil
+}
+
+// unlock releases the uuids of the pending writes, those shared with other instances all at once
+func (w *bulkWriter) unlock() {
+	locks := []*writeLock{}
+	for _, write := range w.pending {
+		locks = append(locks, write.lock)
+	}
+	w.cd.unlock(locks...)
+}
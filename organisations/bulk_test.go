@@ -0,0 +1,63 @@
+package organisations
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteBulkRejectsInvalidLines(t *testing.T) {
+	assert := assert.New(t)
+
+	body := strings.Join([]string{
+		`{"uuid": "` + fullOrgUUID + `", "type": "Charity"}`,
+		``,
+		`{"uuid": `,
+		`{"type": "Organisation"}`,
+	}, "\n")
+
+	report, err := service{}.WriteBulk(strings.NewReader(body), writeOptions{}, "TEST_TRANS_ID")
+
+	assert.NoError(err)
+	assert.Equal(3, report.Rejected)
+	assert.Equal(0, report.Written)
+	assert.Len(report.Results, 3)
+	assert.Equal(bulkLineResult{Line: 1, UUID: fullOrgUUID, Status: bulkRejected, Reason: "type: 'Charity' is not supported, it should be one of Company, Organisation or PublicCompany"}, report.Results[0])
+	assert.Equal(3, report.Results[1].Line)
+	assert.Equal(bulkLineResult{Line: 4, Status: bulkRejected, Reason: "uuid: is required"}, report.Results[2])
+}
+
+func TestWriteBulkInSeveralBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := NewCypherOrganisationService(db, Config{BatchSize: 5})
+	cypherDriver.Initialise()
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(minimalOrg, "TEST_TRANS_ID"))
+
+	body := strings.Join([]string{
+		orgJSON(t, fullOrg),
+		orgJSON(t, minimalOrg),
+		orgJSON(t, dupeOtherIdentifierOrg),
+		orgJSON(t, privateOrg),
+	}, "\n")
+
+	report, err := cypherDriver.WriteBulk(strings.NewReader(body), writeOptions{}, "TEST_TRANS_ID")
+
+	assert.NoError(err)
+	assert.Equal(2, report.Written)
+	assert.Equal(1, report.Skipped)
+	assert.Equal(1, report.Rejected)
+	assert.Equal(bulkLineResult{Line: 1, UUID: fullOrgUUID, Status: bulkWritten}, report.Results[0])
+	assert.Equal(bulkLineResult{Line: 2, UUID: minimalOrgUUID, Status: bulkSkipped}, report.Results[1])
+	assert.Equal(bulkRejected, report.Results[2].Status, "org with an identifier of another org should have been rejected")
+	assert.Equal(bulkLineResult{Line: 4, UUID: privateOrgUUID, Status: bulkWritten}, report.Results[3])
+
+	storedOrg, found, err := cypherDriver.Read(fullOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(fullOrg, storedOrg)
+}
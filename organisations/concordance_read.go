@@ -0,0 +1,91 @@
+package organisations
+
+import (
+	"fmt"
+
+	"github.com/Financial-Times/organisations-rw-neo4j/transfer"
+	"github.com/jmcvetta/neoism"
+)
+
+// concordanceCandidates is what concording the old nodes of an organisation needs to know about them
+type concordanceCandidates struct {
+	uuids         []string
+	nodes         map[string]int
+	organisations map[string]organisation
+	relationships *transfer.Batch
+}
+
+// readConcordanceCandidates reads which of the alternative uuids of the organisation are old nodes, the organisations
+// they are, and their relationships, all in one round trip however many uuids there are
+func (cd service) readConcordanceCandidates(canonicalUUID string, alternativeUUIDs []string) (concordanceCandidates, error) {
+	candidates := concordanceCandidates{
+		uuids:         []string{},
+		nodes:         map[string]int{},
+		organisations: map[string]organisation{},
+	}
+	seen := map[string]bool{canonicalUUID: true}
+	for _, uuid := range alternativeUUIDs {
+		if !seen[uuid] {
+			seen[uuid] = true
+			candidates.uuids = append(candidates.uuids, uuid)
+		}
+	}
+	if len(candidates.uuids) == 0 {
+		return candidates, nil
+	}
+
+	nodes := []struct {
+		UUID  string `json:"uuid"`
+		Count int    `json:"nr"`
+	}{}
+	nodesQuery := &neoism.CypherQuery{
+		Statement: `MATCH (a:Thing) WHERE a.uuid IN {uuids}
+					RETURN a.uuid as uuid, count(a) as nr`,
+		Parameters: map[string]interface{}{
+			"uuids": candidates.uuids,
+		},
+		Result: &nodes,
+	}
+
+	organisations := []organisationResult{}
+	organisationsQuery := constructReadOrganisationsQuery(`MATCH (o:Organisation:Concept) WHERE o.uuid IN {uuids}`,
+		map[string]interface{}{
+			"uuids": candidates.uuids,
+		}, &organisations)
+
+	candidates.relationships = cd.config.relationshipTransfer().NewBatch(canonicalUUID, candidates.uuids)
+
+	queries := append([]*neoism.CypherQuery{nodesQuery, organisationsQuery}, candidates.relationships.Queries()...)
+	if err := cd.conn.CypherBatch(queries); err != nil {
+		return concordanceCandidates{}, err
+	}
+
+	for _, node := range nodes {
+		candidates.nodes[node.UUID] = node.Count
+	}
+	for _, result := range organisations {
+		candidates.organisations[result.UUID] = result.toOrganisation(cd.config.orgTypes())
+	}
+	return candidates, nil
+}
+
+// exists tells whether the uuid is an old node, failing when there is more than one node with it
+func (c concordanceCandidates) exists(uuid string) (bool, error) {
+	switch count := c.nodes[uuid]; {
+	case count == 0:
+		return false, nil
+	case count == 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("DB inconsistence: %d node (instead of max 1) exists with UUID %s", count, uuid)
+	}
+}
+
+// organisation returns the organisation the old node is, or nil if it is not one
+func (c concordanceCandidates) organisation(uuid string) *organisation {
+	o, ok := c.organisations[uuid]
+	if !ok {
+		return nil
+	}
+	return &o
+}
@@ -0,0 +1,187 @@
+package organisations
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/neo-utils-go/neoutils"
+	"github.com/jmcvetta/neoism"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOldNodes stands in for Neo4j when reading concordance candidates: every uuid it holds is a node, and each
+// round trip takes the latency of one to the database
+type fakeOldNodes struct {
+	nodes      map[string]int
+	latency    time.Duration
+	roundTrips int
+}
+
+func (f *fakeOldNodes) CypherBatch(queries []*neoism.CypherQuery) error {
+	f.roundTrips++
+	time.Sleep(f.latency)
+	for _, query := range queries {
+		results := []map[string]interface{}{}
+		switch {
+		case strings.HasPrefix(query.Statement, "match (a:Thing{uuid:{uuid}})"):
+			results = append(results, map[string]interface{}{"nr": f.nodes[query.Parameters["uuid"].(string)]})
+		case strings.HasPrefix(query.Statement, "MATCH (a:Thing) WHERE a.uuid IN {uuids}"):
+			for _, uuid := range query.Parameters["uuids"].([]string) {
+				if count, ok := f.nodes[uuid]; ok {
+					results = append(results, map[string]interface{}{"uuid": uuid, "nr": count})
+				}
+			}
+		}
+		if query.Result == nil {
+			continue
+		}
+		b, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, query.Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeOldNodes) EnsureConstraints(constraints map[string]string) error {
+	return nil
+}
+
+func (f *fakeOldNodes) EnsureIndexes(indexes map[string]string) error {
+	return nil
+}
+
+func oldNodeUUIDs(n int) []string {
+	uuids := []string{}
+	for i := 0; i < n; i++ {
+		uuids = append(uuids, fmt.Sprintf("00000000-0000-0000-0000-%012d", i))
+	}
+	return uuids
+}
+
+func TestReadConcordanceCandidatesInOneRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	uuids := oldNodeUUIDs(3)
+	db := &fakeOldNodes{nodes: map[string]int{uuids[0]: 1, uuids[2]: 1}}
+	cd := NewCypherOrganisationService(db, Config{})
+
+	candidates, err := cd.readConcordanceCandidates(org1UUID, []string{org1UUID, uuids[0], uuids[1], uuids[0], uuids[2]})
+	assert.NoError(err)
+	assert.Equal(1, db.roundTrips)
+	assert.Equal(uuids, candidates.uuids, "candidates should leave out the canonical uuid and repeated ones")
+
+	for uuid, expected := range map[string]bool{uuids[0]: true, uuids[1]: false, uuids[2]: true} {
+		exists, err := candidates.exists(uuid)
+		assert.NoError(err)
+		assert.Equal(expected, exists, uuid)
+	}
+	assert.Nil(candidates.organisation(uuids[0]))
+}
+
+func TestReadConcordanceCandidatesFailsOnDuplicateNodes(t *testing.T) {
+	assert := assert.New(t)
+
+	uuids := oldNodeUUIDs(1)
+	db := &fakeOldNodes{nodes: map[string]int{uuids[0]: 2}}
+	cd := NewCypherOrganisationService(db, Config{})
+
+	candidates, err := cd.readConcordanceCandidates(org1UUID, uuids)
+	assert.NoError(err)
+	_, err = candidates.exists(uuids[0])
+	assert.Error(err)
+}
+
+func TestMergingOldNodesReadsInOneRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	uuids := oldNodeUUIDs(20)
+	db := &fakeOldNodes{nodes: map[string]int{}}
+	for _, uuid := range uuids {
+		db.nodes[uuid] = 1
+	}
+	cd := NewCypherOrganisationService(db, Config{})
+
+	_, merges, err := cd.constructMergingOldOrganisationNodesQueries(org1UUID, uuids, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Len(merges, len(uuids))
+	assert.Equal(1, db.roundTrips)
+}
+
+// BenchmarkReadConcordanceCandidates reads twenty old nodes in one round trip
+func BenchmarkReadConcordanceCandidates(b *testing.B) {
+	uuids := oldNodeUUIDs(20)
+	db := &fakeOldNodes{nodes: map[string]int{}, latency: time.Millisecond}
+	for _, uuid := range uuids {
+		db.nodes[uuid] = 1
+	}
+	cd := NewCypherOrganisationService(db, Config{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cd.readConcordanceCandidates(org1UUID, uuids); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadConcordanceCandidatesPerUUID reads the same twenty old nodes as merging used to, checking each one
+// exists and then reading its relationship types, two round trips per node
+func BenchmarkReadConcordanceCandidatesPerUUID(b *testing.B) {
+	uuids := oldNodeUUIDs(20)
+	db := &fakeOldNodes{nodes: map[string]int{}, latency: time.Millisecond}
+	for _, uuid := range uuids {
+		db.nodes[uuid] = 1
+	}
+	cd := NewCypherOrganisationService(db, Config{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, uuid := range uuids {
+			exists, err := checkNodeExistence(db, uuid)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !exists {
+				continue
+			}
+			if _, _, err := cd.getNodeRelationshipNames(uuid); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// checkNodeExistence is the existence check merging used to run for each alternative uuid
+func checkNodeExistence(db neoutils.CypherRunner, uuid string) (bool, error) {
+	res := []struct {
+		Count int `json:"nr"`
+	}{}
+
+	checkNodeExistenceQuery := &neoism.CypherQuery{
+		Statement: `match (a:Thing{uuid:{uuid}})
+			           return count(a) as nr`,
+		Parameters: map[string]interface{}{
+			"uuid": uuid,
+		},
+		Result: &res,
+	}
+
+	if err := db.CypherBatch([]*neoism.CypherQuery{checkNodeExistenceQuery}); err != nil {
+		return false, err
+	}
+
+	if len(res) != 1 {
+		return false, fmt.Errorf("DB inconsistence: one count result should be returned for node with UUID %s", uuid)
+	}
+	if res[0].Count > 1 {
+		return false, fmt.Errorf("DB inconsistence: %d node (instead of max 1) exists with UUID %s", res[0].Count, uuid)
+	}
+	return res[0].Count == 1, nil
+}
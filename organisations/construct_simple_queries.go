@@ -2,6 +2,8 @@ package organisations
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/jmcvetta/neoism"
 )
 
@@ -38,11 +40,15 @@ func constructDeleteEntityRelationshipQuery(uuid string) *neoism.CypherQuery {
 	return deleteEntityRelationshipsQuery
 }
 
-func constructResetOrganisationQuery(uuid string, props map[string]interface{}) *neoism.CypherQuery {
+// constructResetOrganisationQuery replaces the properties of the organisation, and removes the labels of its type
+// so it can be given those of its new one
+func constructResetOrganisationQuery(uuid string, props map[string]interface{}, typeLabels []string) *neoism.CypherQuery {
 	resetOrgQuery := &neoism.CypherQuery{
-		Statement: `MERGE (o:Thing {uuid: {uuid}})
-					REMOVE o:PublicCompany:Company:Organisation:Concept
-					SET o={props}`,
+		Statement: fmt.Sprintf(`MERGE (o:Thing {uuid: {uuid}})
+					WITH o, coalesce(o.revision, 0) AS revision
+					REMOVE o:%s
+					SET o={props}
+					SET o.revision = revision + 1`, strings.Join(typeLabels, ":")),
 		Parameters: map[string]interface{}{
 			"uuid":  uuid,
 			"props": props,
@@ -62,6 +68,51 @@ func constructDeleteEmptyNodeQuery(uuid string) *neoism.CypherQuery {
 	}
 }
 
+// constructCreateRedirectQuery leaves a redirect from the uuid of a node concorded away to the canonical organisation
+func constructCreateRedirectQuery(uuid string, canonicalUUID string) *neoism.CypherQuery {
+	return &neoism.CypherQuery{
+		Statement: `MATCH (canonical:Thing {uuid:{canonicalUUID}})
+					MERGE (r:Redirect {uuid:{uuid}})
+					WITH r, canonical
+					OPTIONAL MATCH (r)-[old:REDIRECTS_TO]->()
+					DELETE old
+					WITH DISTINCT r, canonical
+					MERGE (r)-[:REDIRECTS_TO]->(canonical)`,
+		Parameters: map[string]interface{}{
+			"uuid":          uuid,
+			"canonicalUUID": canonicalUUID,
+		},
+	}
+}
+
+// constructDeleteRedirectQuery removes the redirect of a uuid which is written as an organisation again
+func constructDeleteRedirectQuery(uuid string) *neoism.CypherQuery {
+	return &neoism.CypherQuery{
+		Statement: `MATCH (r:Redirect {uuid:{uuid}})
+					DETACH DELETE r`,
+		Parameters: map[string]interface{}{
+			"uuid": uuid,
+		},
+	}
+}
+
+// constructRemoveConcordedUUIDQuery removes the uuid of an organisation split back out from the UPP identifiers of the canonical one.
+// The canonical organisation no longer matches its stored hash, so that is removed too
+func constructRemoveConcordedUUIDQuery(canonicalUUID string, uuid string) *neoism.CypherQuery {
+	return &neoism.CypherQuery{
+		Statement: `MATCH (c:Thing {uuid:{canonicalUUID}})
+					OPTIONAL MATCH (c)<-[:IDENTIFIES]-(i:UPPIdentifier {value:{uuid}})
+					DETACH DELETE i
+					WITH DISTINCT c
+					REMOVE c.hash
+					SET c.revision = coalesce(c.revision, 0) + 1`,
+		Parameters: map[string]interface{}{
+			"canonicalUUID": canonicalUUID,
+			"uuid":          uuid,
+		},
+	}
+}
+
 func constructCreateParentOrganisationQuery(uuid string, parentUUID string) *neoism.CypherQuery {
 	return &neoism.CypherQuery{
 		Statement: `MERGE (o:Thing {uuid: {uuid}})
@@ -99,3 +150,73 @@ func createNewIdentifierQuery(uuid string, identifierLabel string, identifierVal
 	}
 	return query
 }
+
+// constructReadOrganisationsQuery reads every organisation bound to o by the given MATCH clause, ordered by uuid
+func constructReadOrganisationsQuery(matchClause string, params map[string]interface{}, results *[]organisationResult) *neoism.CypherQuery {
+	return &neoism.CypherQuery{
+		Statement: matchClause + `
+            			OPTIONAL MATCH (o)-[:SUB_ORGANISATION_OF]->(par:Thing)
+            			OPTIONAL MATCH (o)-[:HAS_CLASSIFICATION]->(ind:Thing)
+           			OPTIONAL MATCH (upp:UPPIdentifier)-[:IDENTIFIES]->(o)
+	    			OPTIONAL MATCH (factset:FactsetIdentifier)-[:IDENTIFIES]->(o)
+	   			OPTIONAL MATCH (tme:TMEIdentifier)-[:IDENTIFIES]->(o)
+	    			OPTIONAL MATCH (lei:LegalEntityIdentifier)-[:IDENTIFIES]->(o)
+	    			OPTIONAL MATCH (market:Identifier)-[:IDENTIFIES]->(o)
+					WHERE market:ISINIdentifier OR market:SEDOLIdentifier OR market:CUSIPIdentifier OR market:TickerIdentifier
+            		 	RETURN o.uuid as uuid,
+					o.properName as properName,
+					labels(o) as Type,
+					o.prefLabel as prefLabel,
+					o.legalName as legalName,
+					o.shortName as shortName,
+					o.hiddenLabel as hiddenLabel,
+					o.formerNames as formerNames,
+					o.tradeNames as tradeNames,
+					o.localNames as localNames,
+					o.aliases as aliases,
+					ind.uuid as industryClassification,
+					par.uuid as parentOrganisation,
+					coalesce(o.revision, 0) as revision,
+					{uuids:collect(distinct upp.value),
+					 TME:collect(distinct tme.value),
+					 factsetIdentifier:factset.value,
+					 leiCode:lei.value} as alternativeIdentifiers,
+					[id IN collect(distinct {labels:labels(market), value:market.value}) WHERE id.value IS NOT NULL] as marketIdentifiers
+				ORDER BY uuid`,
+		Parameters: params,
+		Result:     results,
+	}
+}
+
+// constructListOrganisationsMatchClause matches a page of organisations after the {cursor} uuid, limited to {limit}.
+// Organisations of the excluded subtypes of the type filtered on are left out
+func constructListOrganisationsMatchClause(filter listFilter, excludedSubtypes []string) string {
+	conditions := []string{"o.uuid > {cursor}"}
+
+	if filter.Type != "" {
+		conditions = append(conditions, fmt.Sprintf("o:%s", filter.Type))
+	}
+	for _, subtype := range excludedSubtypes {
+		conditions = append(conditions, fmt.Sprintf("NOT o:%s", subtype))
+	}
+	if filter.HasParent != nil {
+		conditions = append(conditions, existenceCondition(*filter.HasParent, "(o)-[:SUB_ORGANISATION_OF]->(:Thing)"))
+	}
+	if filter.HasIndustryClassification != nil {
+		conditions = append(conditions, existenceCondition(*filter.HasIndustryClassification, "(o)-[:HAS_CLASSIFICATION]->(:Thing)"))
+	}
+	if filter.PrefLabelPrefix != "" {
+		conditions = append(conditions, "o.prefLabel STARTS WITH {prefix}")
+	}
+
+	return fmt.Sprintf(`MATCH (o:Organisation:Concept)
+					WHERE %s
+					WITH o ORDER BY o.uuid LIMIT {limit}`, strings.Join(conditions, " AND "))
+}
+
+func existenceCondition(exists bool, pattern string) string {
+	if exists {
+		return pattern
+	}
+	return "NOT " + pattern
+}
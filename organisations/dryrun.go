@@ -0,0 +1,166 @@
+package organisations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Financial-Times/organisations-rw-neo4j/transfer"
+)
+
+// describePlan returns the result of a planned write with a dry run describing it, in place of running it
+func (cd service) describePlan(o organisation, plan writePlan, transId string) (writeResult, error) {
+	dryRun := &writeDryRun{Summary: []string{}, Queries: []plannedQuery{}}
+	for _, query := range plan.Queries {
+		dryRun.Queries = append(dryRun.Queries, plannedQuery{Statement: query.Statement, Parameters: query.Parameters})
+	}
+
+	result := plan.Result
+	result.DryRun = dryRun
+
+	if !plan.Result.Changed {
+		dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("Organisation %s is unchanged, so nothing would be written", o.UUID))
+		return result, nil
+	}
+
+	stored, revision, exists, err := cd.ReadWithRevision(o.UUID, transId)
+	if err != nil {
+		return writeResult{}, err
+	}
+
+	if exists {
+		dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("Organisation %s would be updated from revision %d to %d", o.UUID, revision, plan.Result.Revision))
+	} else {
+		dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("Organisation %s would be created as %s", o.UUID, o.Type))
+	}
+
+	for _, merge := range plan.Merges {
+		dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("Node %s would be merged into %s, moving %s, and left as a redirect",
+			merge.SourceUUID, o.UUID, describeMovedRelationships(merge.Relationships)))
+		if len(merge.Dropped) > 0 {
+			dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("Node %s would have %s dropped rather than moved", merge.SourceUUID, describeMovedRelationships(merge.Dropped)))
+		}
+		for _, loop := range merge.Loops {
+			dryRun.Summary = append(dryRun.Summary, describeLoop(merge.SourceUUID, o.UUID, loop))
+		}
+		for _, collapse := range merge.Collapsed {
+			dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("%s relationship %s of merged node %s would collapse into an existing one, losing %s",
+				collapse.Type, describeOtherEnd(collapse), merge.SourceUUID, describeProperties(collapse.LostProperties)))
+		}
+		if merge.Source != nil {
+			for _, id := range missingIdentifiers(*merge.Source, o) {
+				dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("%s '%s' of merged organisation %s would be removed", id.Label, id.Value, merge.SourceUUID))
+			}
+		}
+		if len(merge.FoldedFormerNames) > 0 {
+			dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("Names of merged organisation %s would be kept as former names: %s", merge.SourceUUID, strings.Join(merge.FoldedFormerNames, ", ")))
+		}
+		if len(merge.FoldedAliases) > 0 {
+			dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("Aliases of merged organisation %s would be kept as aliases: %s", merge.SourceUUID, strings.Join(merge.FoldedAliases, ", ")))
+		}
+	}
+
+	if exists {
+		for _, id := range missingIdentifiers(stored, o) {
+			dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("%s '%s' would be removed", id.Label, id.Value))
+		}
+		for _, id := range missingIdentifiers(o, stored) {
+			dryRun.Summary = append(dryRun.Summary, fmt.Sprintf("%s '%s' would be added", id.Label, id.Value))
+		}
+		if stored.ParentOrganisation != o.ParentOrganisation {
+			dryRun.Summary = append(dryRun.Summary, describeChange("Parent organisation", stored.ParentOrganisation, o.ParentOrganisation))
+		}
+		if stored.IndustryClassification != o.IndustryClassification {
+			dryRun.Summary = append(dryRun.Summary, describeChange("Industry classification", stored.IndustryClassification, o.IndustryClassification))
+		}
+	}
+
+	return result, nil
+}
+
+func describeMovedRelationships(moved []movedRelationships) string {
+	if len(moved) == 0 {
+		return "no relationships"
+	}
+	descriptions := []string{}
+	for _, rel := range moved {
+		descriptions = append(descriptions, fmt.Sprintf("%d %s %s", rel.Count, rel.Direction, rel.Type))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func describeLoop(sourceUUID string, canonicalUUID string, loop transfer.Loop) string {
+	between := fmt.Sprintf("between %s and %s", sourceUUID, canonicalUUID)
+	if loop.Self {
+		between = fmt.Sprintf("of %s with itself", sourceUUID)
+	}
+	action := "dropped"
+	if loop.Action == transfer.LoopRepointed {
+		action = fmt.Sprintf("kept as a relationship of %s with itself", canonicalUUID)
+	}
+	return fmt.Sprintf("%d %s relationships %s would be %s", loop.Count, loop.Type, between, action)
+}
+
+func describeOtherEnd(collapse transfer.Collapse) string {
+	if collapse.Direction == incomingDirection {
+		return "from " + collapse.OtherUUID
+	}
+	return "to " + collapse.OtherUUID
+}
+
+func describeProperties(properties map[string]interface{}) string {
+	names := []string{}
+	for name, value := range properties {
+		names = append(names, fmt.Sprintf("%s=%v", name, value))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func describeChange(field string, from string, to string) string {
+	if from == "" {
+		from = "none"
+	}
+	if to == "" {
+		to = "none"
+	}
+	return fmt.Sprintf("%s would change from %s to %s", field, from, to)
+}
+
+// missingIdentifiers returns the identifiers of the first organisation which the second one does not have
+func missingIdentifiers(from organisation, to organisation) []identifierValue {
+	toIdentifiers := map[identifierValue]bool{}
+	for _, id := range organisationIdentifiers(to) {
+		toIdentifiers[id] = true
+	}
+
+	missing := []identifierValue{}
+	for _, id := range organisationIdentifiers(from) {
+		if !toIdentifiers[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+func organisationIdentifiers(o organisation) []identifierValue {
+	ids := []identifierValue{}
+	for _, uuid := range o.AlternativeIdentifiers.UUIDS {
+		ids = append(ids, identifierValue{Label: uppIdentifierLabel, Value: uuid})
+	}
+	for _, tme := range o.AlternativeIdentifiers.TME {
+		ids = append(ids, identifierValue{Label: tmeIdentifierLabel, Value: tme})
+	}
+	if o.AlternativeIdentifiers.FactsetIdentifier != "" {
+		ids = append(ids, identifierValue{Label: factsetIdentifierLabel, Value: o.AlternativeIdentifiers.FactsetIdentifier})
+	}
+	if o.AlternativeIdentifiers.LeiCode != "" {
+		ids = append(ids, identifierValue{Label: leiIdentifierLabel, Value: o.AlternativeIdentifiers.LeiCode})
+	}
+	for _, market := range marketIdentifiers {
+		for _, value := range *market.list(&o.AlternativeIdentifiers) {
+			ids = append(ids, identifierValue{Label: market.label, Value: value})
+		}
+	}
+	return ids
+}
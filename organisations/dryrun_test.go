@@ -0,0 +1,52 @@
+package organisations
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/organisations-rw-neo4j/transfer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingIdentifiers(t *testing.T) {
+	assert := assert.New(t)
+
+	updated := fullOrg
+	updated.AlternativeIdentifiers = alternativeIdentifiers{
+		UUIDS:             []string{fullOrgUUID, minimalOrgUUID},
+		TME:               []string{tmeIdentifier},
+		FactsetIdentifier: fsIdentifierOther,
+	}
+
+	assert.Equal([]identifierValue{
+		{Label: factsetIdentifierLabel, Value: fsIdentifier},
+		{Label: leiIdentifierLabel, Value: leiCodeIdentifier},
+	}, missingIdentifiers(fullOrg, updated))
+	assert.Equal([]identifierValue{
+		{Label: uppIdentifierLabel, Value: minimalOrgUUID},
+		{Label: factsetIdentifierLabel, Value: fsIdentifierOther},
+	}, missingIdentifiers(updated, fullOrg))
+	assert.Empty(missingIdentifiers(fullOrg, fullOrg))
+}
+
+func TestDescribeMovedRelationships(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("no relationships", describeMovedRelationships(nil))
+	assert.Equal("3 incoming MENTIONS, 1 outgoing HAS_ROLE", describeMovedRelationships([]movedRelationships{
+		{Type: "MENTIONS", Direction: incomingDirection, Count: 3},
+		{Type: "HAS_ROLE", Direction: outgoingDirection, Count: 1},
+	}))
+}
+
+func TestDescribeLoop(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("1 SUB_ORGANISATION_OF relationships between old and canonical would be dropped",
+		describeLoop("old", "canonical", transfer.Loop{Type: "SUB_ORGANISATION_OF", Direction: incomingDirection, Count: 1, Action: transfer.LoopDropped}))
+	assert.Equal("2 SIMILAR_TO relationships of old with itself would be kept as a relationship of canonical with itself",
+		describeLoop("old", "canonical", transfer.Loop{Type: "SIMILAR_TO", Direction: outgoingDirection, Self: true, Count: 2, Action: transfer.LoopRepointed}))
+}
+
+func TestDescribeProperties(t *testing.T) {
+	assert.Equal(t, "platformVersion=v1, relevanceScore=0.5", describeProperties(map[string]interface{}{"relevanceScore": 0.5, "platformVersion": "v1"}))
+}
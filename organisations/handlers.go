@@ -0,0 +1,644 @@
+package organisations
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/Financial-Times/up-rw-app-api-go/rwapi"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Handler serves the organisation endpoints. It takes over the /organisations routes from baseftrwapp,
+// keeping the behaviour of its GET, PUT, DELETE, __count and __ids handlers
+type Handler struct {
+	svc service
+}
+
+// NewHandler returns a new Handler backed by the given organisations service
+func NewHandler(svc service) Handler {
+	return Handler{svc}
+}
+
+// RegisterHandlers adds the organisation endpoints to the router
+func (h Handler) RegisterHandlers(router *mux.Router) {
+	router.HandleFunc("/organisations", h.GetOrganisations).Methods("GET")
+	router.HandleFunc("/organisations/__count", h.Count).Methods("GET")
+	router.HandleFunc("/organisations/__ids", h.IDs).Methods("GET")
+	router.HandleFunc("/organisations/__bulk", h.BulkWriteOrganisations).Methods("POST")
+	router.HandleFunc("/organisations/{uuid}", h.GetOrganisation).Methods("GET")
+	router.HandleFunc("/organisations/{uuid}", h.PutOrganisation).Methods("PUT")
+	router.HandleFunc("/organisations/{uuid}", h.PatchOrganisation).Methods("PATCH")
+	router.HandleFunc("/organisations/{uuid}", h.DeleteOrganisation).Methods("DELETE")
+	router.HandleFunc("/organisations/{uuid}/ancestors", h.GetAncestors).Methods("GET")
+	router.HandleFunc("/organisations/{uuid}/descendants", h.GetDescendants).Methods("GET")
+	router.HandleFunc("/organisations/{uuid}/siblings", h.GetSiblings).Methods("GET")
+	router.HandleFunc("/organisations/{uuid}/concordances", h.GetConcordanceAudits).Methods("GET")
+	router.HandleFunc("/organisations/{uuid}/__unmerge", h.UnmergeOrganisation).Methods("POST")
+	router.HandleFunc("/organisations/{uuid}/__merge-preview", h.PreviewMerge).Methods("GET")
+}
+
+// PutOrganisation - Writes the organisation in the body, replying whether anything changed.
+// The write is skipped when nothing changed, unless the force query parameter is true.
+// With an If-Match header, the write is rejected with 412 unless the ETag is the stored revision, or for *,
+// unless the organisation exists.
+// When the dryRun query parameter is true, nothing is written and the reply describes the write instead
+func (h Handler) PutOrganisation(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	body, err := requestBody(req)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	inst, docUUID, err := h.svc.DecodeJSON(json.NewDecoder(body))
+	if re, ok := err.(requestError); ok {
+		writeJSONError(w, re.InvalidRequestDetails(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if docUUID != uuid {
+		writeJSONError(w, fmt.Sprintf("uuid does not match: '%v' '%v'", docUUID, uuid), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := writeOptionsFromRequest(req)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.WriteOrganisation(inst.(organisation), opts, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if result.DryRun == nil {
+		w.Header().Set("ETag", formatETag(result.Revision))
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// BulkWriteOrganisations - Writes the newline-delimited organisations in the body, replying what happened to each line
+func (h Handler) BulkWriteOrganisations(w http.ResponseWriter, req *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	body, err := requestBody(req)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	opts, err := writeOptionsFromRequest(req)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.IfMatchRevision != nil || opts.IfMatchAny {
+		writeJSONError(w, "If-Match is not supported on bulk writes", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.svc.WriteBulk(body, opts, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// PatchOrganisation - Applies the JSON merge patch in the body to the organisation.
+// List fields also accept {"add": [...], "remove": [...]} to add or remove single items
+func (h Handler) PatchOrganisation(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	patch := map[string]interface{}{}
+	if err := json.NewDecoder(req.Body).Decode(&patch); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := writeOptionsFromRequest(req)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, found, err := h.svc.Patch(uuid, patch, opts, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if result.DryRun == nil {
+		w.Header().Set("ETag", formatETag(result.Revision))
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// unknownLabelsHeader lists the labels of the organisation read which belong to no organisation type
+const unknownLabelsHeader = "X-Unknown-Labels"
+
+// GetOrganisation - Returns the organisation with the uuid, and its revision as ETag. A uuid concorded into another
+// organisation is redirected to it with a 301, or answered with that organisation when followRedirect is true.
+// Labels of the organisation which belong to no type are listed in the X-Unknown-Labels header
+func (h Handler) GetOrganisation(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	followRedirect, err := optionalBoolParam(req.URL.Query(), "followRedirect")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	o, revision, found, err := h.svc.ReadWithRevision(uuid, tid)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if !found {
+		canonicalUUID, redirected, err := h.svc.ReadRedirect(uuid, tid)
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if !redirected {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		canonicalPath := "/organisations/" + canonicalUUID
+		if followRedirect == nil || !*followRedirect {
+			w.Header().Set("Location", canonicalPath)
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+
+		if o, revision, found, err = h.svc.ReadWithRevision(canonicalUUID, tid); err != nil {
+			writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Location", canonicalPath)
+	}
+
+	w.Header().Set("ETag", formatETag(revision))
+	if len(o.UnknownLabels) > 0 {
+		w.Header().Set(unknownLabelsHeader, strings.Join(o.UnknownLabels, ", "))
+	}
+
+	if err := json.NewEncoder(w).Encode(o); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// DeleteOrganisation - Deletes the organisation with the uuid
+func (h Handler) DeleteOrganisation(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+
+	deleted, err := h.svc.Delete(uuid, tid)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("X-Request-Id", tid)
+
+	if deleted {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Count - Returns the number of organisations
+func (h Handler) Count(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	count, err := h.svc.Count()
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(count); err != nil {
+		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
+
+// IDs - Streams the uuid and hash of every organisation as newline-delimited JSON
+func (h Handler) IDs(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	err := h.svc.IDs(func(id rwapi.IDEntry) (bool, error) {
+		if err := enc.Encode(id); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+
+	if err != nil {
+		log.Errorf("Failed to stream organisation ids: %v", err)
+
+		// we have already replied 200, so closing the connection is the only way left to tell the client about the error
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			log.Panicf("Failed to close the connection after an error: %v", err)
+		}
+		conn.Close()
+	}
+}
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// GetOrganisations - Returns the canonical organisations identified by the identifierType and value query parameters,
+// or a page of all the organisations when no identifier is given
+func (h Handler) GetOrganisations(w http.ResponseWriter, req *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	query := req.URL.Query()
+	identifierType := query.Get("identifierType")
+	value := query.Get("value")
+	if identifierType == "" && value == "" {
+		h.listOrganisations(w, req, tid)
+		return
+	}
+
+	if identifierType == "" || value == "" {
+		writeJSONError(w, "Both identifierType and value query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	orgs, err := h.svc.ReadByIdentifier(identifierType, value, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if len(orgs) == 0 {
+		writeJSONError(w, fmt.Sprintf("No organisation found with %s identifier '%s'", identifierType, value), http.StatusNotFound)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(orgs); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h Handler) listOrganisations(w http.ResponseWriter, req *http.Request, tid string) {
+	query := req.URL.Query()
+
+	filter := listFilter{
+		Type:            OrgType(query.Get("type")),
+		PrefLabelPrefix: query.Get("prefLabelPrefix"),
+	}
+
+	includeSubtypes, err := optionalBoolParam(query, "includeSubtypes")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.IncludeSubtypes = includeSubtypes != nil && *includeSubtypes
+
+	if filter.HasParent, err = optionalBoolParam(query, "hasParent"); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.HasIndustryClassification, err = optionalBoolParam(query, "hasIndustryClassification"); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := limitParam(query)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orgs, next, err := h.svc.List(filter, query.Get("after"), limit, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	setNextLink(w, req, next)
+
+	enc := json.NewEncoder(w)
+	w.Write([]byte("["))
+	for i, o := range orgs {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := enc.Encode(o); err != nil {
+			return
+		}
+	}
+	w.Write([]byte("]\n"))
+}
+
+// GetAncestors - Returns the parent organisations of the organisation with the uuid, up to its ultimate parent
+func (h Handler) GetAncestors(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	ancestors, found, err := h.svc.Ancestors(uuid, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(ancestors); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetDescendants - Returns a page of the sub organisations of the organisation with the uuid, up to the depth query parameter
+func (h Handler) GetDescendants(w http.ResponseWriter, req *http.Request) {
+	depth := 1
+	if d := req.URL.Query().Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil {
+			writeJSONError(w, fmt.Sprintf("depth must be a number between 1 and %d", maxHierarchyDepth), http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.getHierarchyPage(w, req, func(uuid string, cursor string, limit int, tid string) ([]hierarchyNode, string, bool, error) {
+		return h.svc.Descendants(uuid, depth, cursor, limit, tid)
+	})
+}
+
+// GetSiblings - Returns a page of the organisations sharing the parent of the organisation with the uuid
+func (h Handler) GetSiblings(w http.ResponseWriter, req *http.Request) {
+	h.getHierarchyPage(w, req, h.svc.Siblings)
+}
+
+// GetConcordanceAudits - Returns the records of the merges the uuid took part in, whether or not it still exists
+func (h Handler) GetConcordanceAudits(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	audits, err := h.svc.ConcordanceAudits(uuid, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(audits); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// UnmergeOrganisation - Splits the organisation with the uuid back out of the organisation it was concorded into
+func (h Handler) UnmergeOrganisation(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	result, found, err := h.svc.Unmerge(uuid, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if !found {
+		writeJSONError(w, fmt.Sprintf("Organisation %s is not concorded into another organisation", uuid), http.StatusNotFound)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// PreviewMerge - Describes what concording the node in the source query parameter into the organisation with the uuid would do
+func (h Handler) PreviewMerge(w http.ResponseWriter, req *http.Request) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	sourceUUID := req.URL.Query().Get("source")
+	if sourceUUID == "" || sourceUUID == uuid {
+		writeJSONError(w, "The source query parameter should be the uuid of another node", http.StatusBadRequest)
+		return
+	}
+
+	preview, found, err := h.svc.PreviewMerge(uuid, sourceUUID, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if !found {
+		writeJSONError(w, fmt.Sprintf("Either organisation %s or node %s is not found", uuid, sourceUUID), http.StatusNotFound)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(preview); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type hierarchyPageReader func(uuid string, cursor string, limit int, transId string) ([]hierarchyNode, string, bool, error)
+
+func (h Handler) getHierarchyPage(w http.ResponseWriter, req *http.Request, read hierarchyPageReader) {
+	uuid := mux.Vars(req)["uuid"]
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", tid)
+
+	query := req.URL.Query()
+	limit, err := limitParam(query)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nodes, next, found, err := read(uuid, query.Get("after"), limit, tid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	setNextLink(w, req, next)
+
+	if err := json.NewEncoder(w).Encode(nodes); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func limitParam(query url.Values) (int, error) {
+	if query.Get("limit") == "" {
+		return defaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil {
+		return 0, limitError()
+	}
+	return limit, checkLimit(limit)
+}
+
+// checkLimit makes sure a page size is one a listing supports
+func checkLimit(limit int) error {
+	if limit < 1 || limit > maxListLimit {
+		return limitError()
+	}
+	return nil
+}
+
+func limitError() error {
+	return fmt.Errorf("limit must be a number between 1 and %d", maxListLimit)
+}
+
+// setNextLink points the Link header at the page after the next cursor, if there is one
+func setNextLink(w http.ResponseWriter, req *http.Request, next string) {
+	if next == "" {
+		return
+	}
+	nextURL := *req.URL
+	nextQuery := nextURL.Query()
+	nextQuery.Set("after", next)
+	nextURL.RawQuery = nextQuery.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.RequestURI()))
+}
+
+func optionalBoolParam(query url.Values, name string) (*bool, error) {
+	if query.Get(name) == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(query.Get(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &b, nil
+}
+
+// requestBody returns the body of the request, unzipping it if needed
+func requestBody(req *http.Request) (io.ReadCloser, error) {
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		return gzip.NewReader(req.Body)
+	}
+	return req.Body, nil
+}
+
+func writeOptionsFromRequest(req *http.Request) (writeOptions, error) {
+	force, err := optionalBoolParam(req.URL.Query(), "force")
+	if err != nil {
+		return writeOptions{}, err
+	}
+	dryRun, err := optionalBoolParam(req.URL.Query(), "dryRun")
+	if err != nil {
+		return writeOptions{}, err
+	}
+
+	opts := writeOptions{Force: force != nil && *force, DryRun: dryRun != nil && *dryRun}
+	if ifMatch := req.Header.Get("If-Match"); ifMatch == "*" {
+		opts.IfMatchAny = true
+	} else if ifMatch != "" {
+		revision, err := parseETag(ifMatch)
+		if err != nil {
+			return writeOptions{}, err
+		}
+		opts.IfMatchRevision = &revision
+	}
+	return opts, nil
+}
+
+func formatETag(revision int) string {
+	return fmt.Sprintf(`"%d"`, revision)
+}
+
+// parseETag reads the revision of an ETag. Weak ETags are accepted, as a revision identifies the organisation exactly
+func parseETag(etag string) (int, error) {
+	revision, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(etag, "W/"), `"`), `"`))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid ETag %s, it should be one returned by a GET of the organisation", etag)
+	}
+	return revision, nil
+}
+
+// concurrentWriteRetryAfter is the number of seconds a write refused because of a concurrent one is retried after
+const concurrentWriteRetryAfter = 1
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch e := err.(type) {
+	case rwapi.ConstraintOrTransactionError:
+		writeJSONError(w, e.Error(), http.StatusConflict)
+	case requestError:
+		writeJSONError(w, e.InvalidRequestDetails(), http.StatusBadRequest)
+	case preconditionFailedError:
+		writeJSONError(w, e.PreconditionFailedDetails(), http.StatusPreconditionFailed)
+	case concurrentWriteError:
+		w.Header().Set("Retry-After", strconv.Itoa(concurrentWriteRetryAfter))
+		writeJSONError(w, e.ConcurrentWriteDetails(), http.StatusConflict)
+	default:
+		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, errorMsg string, statusCode int) {
+	w.WriteHeader(statusCode)
+	msg, _ := json.Marshal(map[string]string{"message": errorMsg})
+	fmt.Fprintln(w, string(msg))
+}
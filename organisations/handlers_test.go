@@ -0,0 +1,203 @@
+package organisations
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrganisationsRequiresIdentifierTypeAndValue(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequest("GET", "/organisations?identifierType=factset")
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestGetOrganisationsRejectsUnsupportedIdentifierType(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequest("GET", "/organisations?identifierType=isbn&value=123")
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), "Unsupported identifier type 'isbn'")
+}
+
+func TestListOrganisationsRejectsInvalidParameters(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, url := range []string{
+		"/organisations?hasParent=maybe",
+		"/organisations?hasIndustryClassification=1x",
+		"/organisations?includeSubtypes=all",
+		"/organisations?limit=0",
+		"/organisations?limit=5000",
+		"/organisations?type=Charity",
+	} {
+		rec := serveOrganisationsRequest("GET", url)
+		assert.Equal(http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestPutOrganisationRejectsMismatchedUUID(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequestWithBody("PUT", "/organisations/"+fullOrgUUID, `{"uuid":"`+minimalOrgUUID+`","type":"Organisation"}`)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), "uuid does not match")
+}
+
+func TestPutOrganisationRejectsInvalidJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequestWithBody("PUT", "/organisations/"+fullOrgUUID, `{"uuid":`)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestPutOrganisationListsInvalidFields(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequestWithBody("PUT", "/organisations/"+fullOrgUUID,
+		`{"uuid":"`+fullOrgUUID+`","type":"Organisation","parentOrganisation":"parentOrgUUID","alternativeIdentifiers":{"leiCode":"549300u1ow41qpkyw028"}}`)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), "parentOrganisation: 'parentOrgUUID' is not a valid uuid")
+	assert.Contains(rec.Body.String(), "alternativeIdentifiers.leiCode: '549300u1ow41qpkyw028'")
+}
+
+func TestPutOrganisationRejectsOwnParent(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := NewCypherOrganisationService(&storedState{}, Config{})
+	rec := serveRequestWithBody(svc, "PUT", "/organisations/"+fullOrgUUID,
+		`{"uuid":"`+fullOrgUUID+`","type":"Organisation","parentOrganisation":"`+fullOrgUUID+`"}`)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	body := map[string]string{}
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&body))
+	assert.Contains(body["message"], fullOrgUUID+" -> "+fullOrgUUID)
+}
+
+func TestPutOrganisationRejectsInvalidForce(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequestWithBody("PUT", "/organisations/"+fullOrgUUID+"?force=maybe", `{"uuid":"`+fullOrgUUID+`","type":"Organisation"}`)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestPutOrganisationRejectsInvalidDryRun(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequestWithBody("PUT", "/organisations/"+fullOrgUUID+"?dryRun=maybe", `{"uuid":"`+fullOrgUUID+`","type":"Organisation"}`)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestPutOrganisationRejectsInvalidIfMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	router := mux.NewRouter()
+	NewHandler(service{}).RegisterHandlers(router)
+	req, _ := http.NewRequest("PUT", "/organisations/"+fullOrgUUID, strings.NewReader(`{"uuid":"`+fullOrgUUID+`","type":"Organisation"}`))
+	req.Header.Set("If-Match", `W/"abc"`)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestBulkWriteRejectsIfMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	router := mux.NewRouter()
+	NewHandler(service{}).RegisterHandlers(router)
+	req, _ := http.NewRequest("POST", "/organisations/__bulk", strings.NewReader(`{"uuid":"`+fullOrgUUID+`","type":"Organisation"}`))
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestBulkWriteReportsRejectedLines(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := serveOrganisationsRequestWithBody("POST", "/organisations/__bulk", "{\"uuid\": \n{\"uuid\": \""+fullOrgUUID+"\"}\n")
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"rejected":2`)
+}
+
+func TestETagRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	revision, err := parseETag(formatETag(42))
+
+	assert.NoError(err)
+	assert.Equal(42, revision)
+
+	revision, err = parseETag("W/" + formatETag(42))
+	assert.NoError(err)
+	assert.Equal(42, revision, "a weak ETag should be read as the revision")
+}
+
+func TestIfMatchAnyRevision(t *testing.T) {
+	assert := assert.New(t)
+
+	req, _ := http.NewRequest("PUT", "/organisations/"+fullOrgUUID, nil)
+	req.Header.Set("If-Match", "*")
+	opts, err := writeOptionsFromRequest(req)
+
+	assert.NoError(err)
+	assert.True(opts.IfMatchAny)
+	assert.Nil(opts.IfMatchRevision)
+}
+
+func TestGetDescendantsRejectsInvalidDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, depth := range []string{"deep", "0", "11"} {
+		rec := serveOrganisationsRequest("GET", "/organisations/"+fullOrgUUID+"/descendants?depth="+depth)
+		assert.Equal(http.StatusBadRequest, rec.Code, "depth="+depth)
+	}
+}
+
+func TestPreviewMergeRequiresAnotherSource(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, query := range []string{"", "?source=" + fullOrgUUID} {
+		rec := serveOrganisationsRequest("GET", "/organisations/"+fullOrgUUID+"/__merge-preview"+query)
+		assert.Equal(http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func serveOrganisationsRequest(method string, url string) *httptest.ResponseRecorder {
+	return serveOrganisationsRequestWithBody(method, url, "")
+}
+
+func serveOrganisationsRequestWithBody(method string, url string, body string) *httptest.ResponseRecorder {
+	return serveRequestWithBody(service{}, method, url, body)
+}
+
+func serveRequestWithBody(svc service, method string, url string, body string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	NewHandler(svc).RegisterHandlers(router)
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,35 @@
+package organisations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// hashOrganisation returns a hash of the organisation which does not depend on the order of its identifier sets
+func hashOrganisation(o organisation) (string, error) {
+	o.AlternativeIdentifiers.TME = sortedCopy(o.AlternativeIdentifiers.TME)
+	o.AlternativeIdentifiers.UUIDS = sortedCopy(o.AlternativeIdentifiers.UUIDS)
+	for _, market := range marketIdentifiers {
+		list := market.list(&o.AlternativeIdentifiers)
+		*list = sortedCopy(*list)
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sortedCopy(items []string) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	sorted := append([]string{}, items...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,71 @@
+package organisations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashIgnoresIdentifierOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	reordered := fullOrg
+	reordered.AlternativeIdentifiers.TME = []string{tmeIdentifierAnother, tmeIdentifier}
+	original := fullOrg
+	original.AlternativeIdentifiers.TME = []string{tmeIdentifier, tmeIdentifierAnother}
+
+	originalHash, err := hashOrganisation(original)
+	assert.NoError(err)
+	reorderedHash, err := hashOrganisation(reordered)
+	assert.NoError(err)
+
+	assert.Equal(originalHash, reorderedHash)
+	assert.Equal([]string{tmeIdentifierAnother, tmeIdentifier}, reordered.AlternativeIdentifiers.TME, "hashing should not reorder the organisation")
+}
+
+func TestHashChangesWithContent(t *testing.T) {
+	assert := assert.New(t)
+
+	renamed := fullOrg
+	renamed.PrefLabel = "Renamed"
+
+	originalHash, err := hashOrganisation(fullOrg)
+	assert.NoError(err)
+	renamedHash, err := hashOrganisation(renamed)
+	assert.NoError(err)
+
+	assert.NotEqual(originalHash, renamedHash)
+}
+
+func TestHashTreatsEmptyAndMissingIdentifiersAlike(t *testing.T) {
+	assert := assert.New(t)
+
+	empty := minimalOrg
+	empty.AlternativeIdentifiers.TME = []string{}
+	missing := minimalOrg
+	missing.AlternativeIdentifiers.TME = nil
+
+	emptyHash, err := hashOrganisation(empty)
+	assert.NoError(err)
+	missingHash, err := hashOrganisation(missing)
+	assert.NoError(err)
+
+	assert.Equal(emptyHash, missingHash)
+}
+
+func TestHashIgnoresMarketIdentifierOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	original := fullOrg
+	original.AlternativeIdentifiers.ISINs = []string{"US0378331005", "GB0002634946"}
+	reordered := fullOrg
+	reordered.AlternativeIdentifiers.ISINs = []string{"GB0002634946", "US0378331005"}
+
+	originalHash, err := hashOrganisation(original)
+	assert.NoError(err)
+	reorderedHash, err := hashOrganisation(reordered)
+	assert.NoError(err)
+
+	assert.Equal(originalHash, reorderedHash)
+	assert.Equal([]string{"GB0002634946", "US0378331005"}, reordered.AlternativeIdentifiers.ISINs, "hashing should not reorder the organisation")
+}
@@ -0,0 +1,200 @@
+package organisations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmcvetta/neoism"
+)
+
+// checkParentCycle rejects an organisation whose parent is, directly or through the existing SUB_ORGANISATION_OF chain,
+// a sub organisation of itself. The alternative uuids count as the organisation, as those nodes get merged into it
+func (cd service) checkParentCycle(o organisation) error {
+	if o.ParentOrganisation == "" {
+		return nil
+	}
+
+	uuids := append([]string{o.UUID}, o.AlternativeIdentifiers.UUIDS...)
+	for _, uuid := range uuids {
+		if uuid == o.ParentOrganisation {
+			return parentCycleError(o, []string{o.ParentOrganisation})
+		}
+	}
+
+	results := []struct {
+		Parent string   `json:"parent"`
+		Path   []string `json:"path"`
+	}{}
+
+	cycleQuery := &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (:UPPIdentifier {value:{parentUUID}})-[:IDENTIFIES]->(parent:Thing)
+				OPTIONAL MATCH (o:Thing) WHERE o.uuid IN {uuids} AND o <> parent
+				OPTIONAL MATCH p = shortestPath((parent)-[:SUB_ORGANISATION_OF*..%d]->(o))
+				RETURN parent.uuid as parent, [n IN nodes(p) | n.uuid] as path
+				ORDER BY length(p)`, maxHierarchyChain),
+		Parameters: map[string]interface{}{
+			"parentUUID": o.ParentOrganisation,
+			"uuids":      uuids,
+		},
+		Result: &results,
+	}
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{cycleQuery}); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		for _, uuid := range uuids {
+			if result.Parent == uuid {
+				return parentCycleError(o, []string{result.Parent})
+			}
+		}
+		if len(result.Path) > 0 {
+			return parentCycleError(o, result.Path)
+		}
+	}
+
+	return nil
+}
+
+func parentCycleError(o organisation, pathFromParent []string) error {
+	path := append([]string{o.UUID}, pathFromParent...)
+	return requestError{fmt.Sprintf("parentOrganisation: %s cannot be a sub organisation of %s, as that would create the cycle %s",
+		o.UUID, o.ParentOrganisation, strings.Join(path, " -> "))}
+}
+
+const (
+	maxHierarchyDepth = 10
+	// maxHierarchyChain bounds the walks up SUB_ORGANISATION_OF chains, which are not limited by a requested depth
+	maxHierarchyChain = 100
+)
+
+type hierarchyNodeResult struct {
+	UUID               string   `json:"uuid"`
+	PrefLabel          string   `json:"prefLabel"`
+	Types              []string `json:"types"`
+	ParentOrganisation string   `json:"parentOrganisation"`
+	Depth              int      `json:"depth"`
+}
+
+func (result hierarchyNodeResult) toHierarchyNode(types OrgTypes) hierarchyNode {
+	node := hierarchyNode{
+		UUID:               result.UUID,
+		PrefLabel:          result.PrefLabel,
+		ParentOrganisation: result.ParentOrganisation,
+		Depth:              result.Depth,
+	}
+	node.Type, node.UnknownLabels = types.readType(result.Types)
+	return node
+}
+
+//Ancestors - Returns the parent organisations of an organisation, from its direct parent up to its ultimate parent
+func (cd service) Ancestors(uuid string, transId string) ([]hierarchyNode, bool, error) {
+	results := []struct {
+		Ancestors []hierarchyNodeResult `json:"ancestors"`
+	}{}
+
+	// an existing cycle has no ultimate parent, in which case the chain is read up to where it starts repeating
+	ancestorsQuery := &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (o:Organisation:Concept {uuid:{uuid}})
+				OPTIONAL MATCH p = (o)-[:SUB_ORGANISATION_OF*1..%d]->(a:Thing)
+				WITH o, p ORDER BY length(p) DESC LIMIT 1
+				RETURN [n IN tail(nodes(p)) | {uuid: n.uuid, prefLabel: n.prefLabel, types: labels(n)}] as ancestors`, maxHierarchyChain),
+		Parameters: map[string]interface{}{
+			"uuid": uuid,
+		},
+		Result: &results,
+	}
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{ancestorsQuery}); err != nil {
+		return nil, false, err
+	}
+
+	if len(results) == 0 {
+		return nil, false, nil
+	}
+
+	ancestors := []hierarchyNode{}
+	for i, result := range results[0].Ancestors {
+		result.Depth = i + 1
+		if i+1 < len(results[0].Ancestors) {
+			result.ParentOrganisation = results[0].Ancestors[i+1].UUID
+		}
+		ancestors = append(ancestors, result.toHierarchyNode(cd.config.orgTypes()))
+	}
+
+	return ancestors, true, nil
+}
+
+//Descendants - Returns a page of the sub organisations of an organisation up to the given depth, in uuid order, starting after the cursor uuid.
+//The returned cursor is empty when there are no further pages
+func (cd service) Descendants(uuid string, depth int, cursor string, limit int, transId string) ([]hierarchyNode, string, bool, error) {
+	if depth < 1 || depth > maxHierarchyDepth {
+		return nil, "", false, requestError{fmt.Sprintf("depth must be a number between 1 and %d", maxHierarchyDepth)}
+	}
+
+	statement := fmt.Sprintf(`MATCH (o:Organisation:Concept {uuid:{uuid}})
+				OPTIONAL MATCH p = (d:Thing)-[:SUB_ORGANISATION_OF*1..%d]->(o)
+				WHERE d <> o AND d.uuid > {cursor}
+				WITH o, d, min(length(p)) as depth
+				ORDER BY d.uuid LIMIT {limit}
+				OPTIONAL MATCH (d)-[:SUB_ORGANISATION_OF]->(par:Thing)`, depth)
+
+	return cd.readHierarchyPage(statement, uuid, cursor, limit)
+}
+
+//Siblings - Returns a page of the other sub organisations of the parent of an organisation, in uuid order, starting after the cursor uuid.
+//The returned cursor is empty when there are no further pages
+func (cd service) Siblings(uuid string, cursor string, limit int, transId string) ([]hierarchyNode, string, bool, error) {
+	statement := `MATCH (o:Organisation:Concept {uuid:{uuid}})
+				OPTIONAL MATCH (o)-[:SUB_ORGANISATION_OF]->(par:Thing)<-[:SUB_ORGANISATION_OF]-(d:Thing)
+				WHERE d <> o AND d.uuid > {cursor}
+				WITH o, d, par, 0 as depth
+				ORDER BY d.uuid LIMIT {limit}`
+
+	return cd.readHierarchyPage(statement, uuid, cursor, limit)
+}
+
+// readHierarchyPage reads the d nodes matched by the statement. The statement matches the organisation o, then its d nodes
+// and their par parents optionally, so the organisation is found even when it has no such nodes
+func (cd service) readHierarchyPage(statement string, uuid string, cursor string, limit int) ([]hierarchyNode, string, bool, error) {
+	results := []hierarchyNodeResult{}
+
+	// read one more than asked for so we know whether there is a next page
+	pageQuery := &neoism.CypherQuery{
+		Statement: statement + `
+				RETURN d.uuid as uuid, d.prefLabel as prefLabel, labels(d) as types, par.uuid as parentOrganisation, depth
+				ORDER BY uuid`,
+		Parameters: map[string]interface{}{
+			"uuid":   uuid,
+			"cursor": cursor,
+			"limit":  limit + 1,
+		},
+		Result: &results,
+	}
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{pageQuery}); err != nil {
+		return nil, "", false, err
+	}
+
+	if len(results) == 0 {
+		return nil, "", false, nil
+	}
+
+	next := ""
+	if len(results) > limit {
+		results = results[:limit]
+		next = results[limit-1].UUID
+	}
+
+	nodes := []hierarchyNode{}
+	for _, result := range results {
+		// the organisation was found without any such nodes
+		if result.UUID == "" {
+			continue
+		}
+		nodes = append(nodes, result.toHierarchyNode(cd.config.orgTypes()))
+	}
+
+	return nodes, next, true, nil
+}
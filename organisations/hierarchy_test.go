@@ -0,0 +1,132 @@
+package organisations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var hierarchyParentOrg = organisation{
+	UUID:      parentOrgUUID,
+	Type:      Organisation,
+	PrefLabel: "Parent Org",
+	AlternativeIdentifiers: alternativeIdentifiers{
+		UUIDS: []string{parentOrgUUID},
+	},
+	ParentOrganisation: minimalOrgUUID,
+}
+
+var hierarchySiblingOrg = organisation{
+	UUID:      dupeLeiIdentifierOrgUUID,
+	Type:      Company,
+	PrefLabel: "Sibling Org",
+	AlternativeIdentifiers: alternativeIdentifiers{
+		UUIDS: []string{dupeLeiIdentifierOrgUUID},
+	},
+	ParentOrganisation: parentOrgUUID,
+}
+
+// writeHierarchy writes minimalOrg <- hierarchyParentOrg <- fullOrg and hierarchySiblingOrg
+func writeHierarchy(assert *assert.Assertions, cypherDriver service) {
+	assert.NoError(cypherDriver.Write(minimalOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(hierarchyParentOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(hierarchySiblingOrg, "TEST_TRANS_ID"))
+}
+
+func TestAncestorsUpToUltimateParent(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	writeHierarchy(assert, cypherDriver)
+
+	ancestors, found, err := cypherDriver.Ancestors(fullOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal([]hierarchyNode{
+		{UUID: parentOrgUUID, PrefLabel: "Parent Org", Type: Organisation, ParentOrganisation: minimalOrgUUID, Depth: 1},
+		{UUID: minimalOrgUUID, Type: Organisation, Depth: 2},
+	}, ancestors)
+
+	ancestors, found, err = cypherDriver.Ancestors(minimalOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Empty(ancestors)
+
+	_, found, err = cypherDriver.Ancestors(privateOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(found)
+}
+
+func TestDescendantsUpToDepthInPages(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	writeHierarchy(assert, cypherDriver)
+
+	descendants, next, found, err := cypherDriver.Descendants(minimalOrgUUID, 1, "", 10, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Empty(next)
+	assert.Equal([]hierarchyNode{
+		{UUID: parentOrgUUID, PrefLabel: "Parent Org", Type: Organisation, ParentOrganisation: minimalOrgUUID, Depth: 1},
+	}, descendants)
+
+	descendants, next, found, err = cypherDriver.Descendants(minimalOrgUUID, 2, "", 2, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(parentOrgUUID, next)
+	assert.Equal([]hierarchyNode{
+		{UUID: fullOrgUUID, PrefLabel: "Pref label", Type: PublicCompany, ParentOrganisation: parentOrgUUID, Depth: 2},
+		{UUID: parentOrgUUID, PrefLabel: "Parent Org", Type: Organisation, ParentOrganisation: minimalOrgUUID, Depth: 1},
+	}, descendants)
+
+	descendants, next, found, err = cypherDriver.Descendants(minimalOrgUUID, 2, next, 2, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Empty(next)
+	assert.Equal([]hierarchyNode{
+		{UUID: dupeLeiIdentifierOrgUUID, PrefLabel: "Sibling Org", Type: Company, ParentOrganisation: parentOrgUUID, Depth: 2},
+	}, descendants)
+
+	descendants, _, found, err = cypherDriver.Descendants(fullOrgUUID, 1, "", 10, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Empty(descendants)
+}
+
+func TestSiblingsShareTheParent(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	writeHierarchy(assert, cypherDriver)
+
+	siblings, next, found, err := cypherDriver.Siblings(fullOrgUUID, "", 10, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Empty(next)
+	assert.Equal([]hierarchyNode{
+		{UUID: dupeLeiIdentifierOrgUUID, PrefLabel: "Sibling Org", Type: Company, ParentOrganisation: parentOrgUUID},
+	}, siblings)
+
+	siblings, _, found, err = cypherDriver.Siblings(minimalOrgUUID, "", 10, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Empty(siblings)
+}
+
+func TestDescendantsRejectsDepthOutOfRange(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, _, err := service{}.Descendants(minimalOrgUUID, maxHierarchyDepth+1, "", 10, "TEST_TRANS_ID")
+	assert.IsType(requestError{}, err)
+}
@@ -0,0 +1,241 @@
+package organisations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/neo-utils-go/neoutils"
+	"github.com/jmcvetta/neoism"
+	log "github.com/sirupsen/logrus"
+)
+
+// writeLockTTL is how long a lock taken in Neo4j lasts unless it is released, so the locks of an instance which
+// stopped in the middle of a write do not hold its uuids for ever
+const writeLockTTL = 5 * time.Minute
+
+// writeLocks are the uuids being written by this instance. A write concording old nodes reads them and moves their
+// relationships in separate transactions, so two writes claiming the same uuid at once could lose relationships.
+// The uuids are locked in Neo4j as well, for the writes of other instances
+var writeLocks = newUUIDLocks()
+
+// uuidLocks is a set of locked uuids, which are locked together or not at all
+type uuidLocks struct {
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+func newUUIDLocks() *uuidLocks {
+	return &uuidLocks{locked: map[string]bool{}}
+}
+
+// tryLock locks all the uuids without waiting, returning a func unlocking them. It fails with a concurrentWriteError,
+// locking none of them, if any is locked already
+func (l *uuidLocks) tryLock(uuids []string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	busy := []string{}
+	toLock := []string{}
+	seen := map[string]bool{}
+	for _, uuid := range uuids {
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+		if l.locked[uuid] {
+			busy = append(busy, uuid)
+		}
+		toLock = append(toLock, uuid)
+	}
+	if len(busy) > 0 {
+		return nil, concurrentWriteError{fmt.Sprintf("Another write is in progress for %s, retry once it has finished", strings.Join(busy, ", "))}
+	}
+
+	for _, uuid := range toLock {
+		l.locked[uuid] = true
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, uuid := range toLock {
+				delete(l.locked, uuid)
+			}
+		})
+	}, nil
+}
+
+// writeLock is the lock of a write on its uuids. It is held in this instance, and when the write is shared, in Neo4j too
+type writeLock struct {
+	uuids []string
+	// owner is the id of its WriteLock nodes, or empty while the lock is not shared
+	owner          string
+	unlockInstance func()
+}
+
+// lockWrite locks the uuid of the organisation, every alternative uuid it may concord and its parent's, and reads the
+// stored state of the organisation, which stays true until the lock is released. The lock is only shared with other
+// instances when the write depends on more than its own payload: when it concords old nodes, expects a revision, or
+// gives the organisation a new parent, which must not make a cycle. The state is then read again once the lock is shared
+func (cd service) lockWrite(o organisation, opts writeOptions) (writeState, *writeLock, error) {
+	lock, err := cd.lockInstance(writeUUIDs(o))
+	if err != nil {
+		return writeState{}, nil, err
+	}
+
+	state, err := cd.readWriteState(o)
+	newParent := o.ParentOrganisation != "" && o.ParentOrganisation != state.Parent
+	if err == nil && (state.OldNodes > 0 || opts.IfMatchRevision != nil || opts.IfMatchAny || newParent) {
+		if err = cd.share(lock); err == nil {
+			state, err = cd.readWriteState(o)
+		}
+	}
+	if err != nil {
+		cd.unlock(lock)
+		return writeState{}, nil, err
+	}
+	return state, lock, nil
+}
+
+// writeUUIDs are the uuids a write of the organisation locks: its own, its alternative ones and its parent's
+func writeUUIDs(o organisation) []string {
+	uuids := append([]string{o.UUID}, o.AlternativeIdentifiers.UUIDS...)
+	if o.ParentOrganisation != "" {
+		uuids = append(uuids, o.ParentOrganisation)
+	}
+	return uuids
+}
+
+// lockUUIDs locks the uuids in this instance and in Neo4j, so that no other instance writes them either.
+// It fails with a concurrentWriteError, locking none of them, if any is locked already
+func (cd service) lockUUIDs(uuids []string) (*writeLock, error) {
+	lock, err := cd.lockInstance(uuids)
+	if err != nil {
+		return nil, err
+	}
+	if err := cd.share(lock); err != nil {
+		cd.unlock(lock)
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (cd service) lockInstance(uuids []string) (*writeLock, error) {
+	unlockInstance, err := writeLocks.tryLock(uuids)
+	if err != nil {
+		return nil, err
+	}
+	return &writeLock{uuids: uuids, unlockInstance: unlockInstance}, nil
+}
+
+// share takes the WriteLock node of each uuid of the lock which is free or has expired, in a transaction of its own.
+// It fails with a concurrentWriteError if another write holds any of them, releasing those it took
+func (cd service) share(lock *writeLock) error {
+	owner, err := newWriteLockOwner()
+	if err != nil {
+		return err
+	}
+	lock.owner = owner
+
+	results := []struct {
+		UUID  string `json:"uuid"`
+		Owner string `json:"owner"`
+	}{}
+
+	claimQuery := &neoism.CypherQuery{
+		Statement: `UNWIND {uuids} AS uuid
+					WITH DISTINCT uuid
+					MERGE (l:WriteLock {uuid: uuid})
+					SET l.claiming = true
+					WITH l, coalesce(l.expires, 0) < timestamp() AS free
+					SET l.owner = CASE WHEN free THEN {owner} ELSE l.owner END,
+						l.expires = CASE WHEN free THEN timestamp() + {ttl} ELSE l.expires END
+					REMOVE l.claiming
+					RETURN l.uuid as uuid, l.owner as owner`,
+		Parameters: map[string]interface{}{
+			"uuids": lock.uuids,
+			"owner": owner,
+			"ttl":   int64(writeLockTTL / time.Millisecond),
+		},
+		Result: &results,
+	}
+
+	busy := []string{}
+	err = cd.lockRunner().CypherBatch([]*neoism.CypherQuery{claimQuery})
+	if isTransientError(err) {
+		// a deadlock with the claim of another write
+		busy, err = lock.uuids, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Owner != owner {
+			busy = append(busy, result.UUID)
+		}
+	}
+	if len(busy) > 0 {
+		cd.releaseShared([]string{owner})
+		lock.owner = ""
+		return concurrentWriteError{fmt.Sprintf("Another write is in progress for %s, retry once it has finished", strings.Join(busy, ", "))}
+	}
+	return nil
+}
+
+// unlock releases the locks, deleting the WriteLock nodes of all those which are shared in one transaction
+func (cd service) unlock(locks ...*writeLock) {
+	owners := []string{}
+	for _, lock := range locks {
+		if lock != nil && lock.owner != "" {
+			owners = append(owners, lock.owner)
+			lock.owner = ""
+		}
+	}
+	if len(owners) > 0 {
+		cd.releaseShared(owners)
+	}
+
+	for _, lock := range locks {
+		if lock != nil {
+			lock.unlockInstance()
+		}
+	}
+}
+
+// newWriteLockOwner returns a random id for the WriteLock nodes taken by one write
+func newWriteLockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// releaseShared deletes the WriteLock nodes of the owners. Nodes which cannot be deleted are only logged, as they expire
+func (cd service) releaseShared(owners []string) {
+	releaseQuery := &neoism.CypherQuery{
+		Statement: `MATCH (l:WriteLock) WHERE l.owner IN {owners}
+					DELETE l`,
+		Parameters: map[string]interface{}{
+			"owners": owners,
+		},
+	}
+
+	if err := cd.lockRunner().CypherBatch([]*neoism.CypherQuery{releaseQuery}); err != nil {
+		log.Warnf("Failed to release write locks, they expire in %v: %v", writeLockTTL, err)
+	}
+}
+
+// lockRunner runs the queries of the WriteLock nodes
+func (cd service) lockRunner() neoutils.CypherRunner {
+	if cd.config.LockRunner != nil {
+		return cd.config.LockRunner
+	}
+	return cd.conn
+}
@@ -0,0 +1,266 @@
+package organisations
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jmcvetta/neoism"
+	"github.com/stretchr/testify/assert"
+)
+
+// sharedWriteLocks stands in for the WriteLock nodes in Neo4j, which the instances of the service share. It holds the
+// owner of each locked uuid, none of which expire, and counts the transactions run on them
+type sharedWriteLocks struct {
+	owners       map[string]string
+	transactions int
+}
+
+func (f *sharedWriteLocks) CypherBatch(queries []*neoism.CypherQuery) error {
+	f.transactions++
+	for _, query := range queries {
+		switch {
+		case strings.HasPrefix(query.Statement, "UNWIND {uuids} AS uuid"):
+			owner := query.Parameters["owner"].(string)
+			results := []map[string]interface{}{}
+			for _, uuid := range query.Parameters["uuids"].([]string) {
+				if _, locked := f.owners[uuid]; !locked {
+					f.owners[uuid] = owner
+				}
+				results = append(results, map[string]interface{}{"uuid": uuid, "owner": f.owners[uuid]})
+			}
+			b, err := json.Marshal(results)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(b, query.Result); err != nil {
+				return err
+			}
+		case strings.HasPrefix(query.Statement, "MATCH (l:WriteLock)"):
+			for _, owner := range query.Parameters["owners"].([]string) {
+				for uuid := range f.owners {
+					if f.owners[uuid] == owner {
+						delete(f.owners, uuid)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (f *sharedWriteLocks) EnsureConstraints(constraints map[string]string) error {
+	return nil
+}
+
+func (f *sharedWriteLocks) EnsureIndexes(indexes map[string]string) error {
+	return nil
+}
+
+// storedState stands in for Neo4j holding the organisation being written, answering the reads of its state
+type storedState struct {
+	state writeState
+	reads int
+}
+
+func (f *storedState) CypherBatch(queries []*neoism.CypherQuery) error {
+	for _, query := range queries {
+		if !strings.HasPrefix(query.Statement, "OPTIONAL MATCH (o:Organisation {uuid:{uuid}})") {
+			continue
+		}
+		f.reads++
+		b, err := json.Marshal([]writeState{f.state})
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, query.Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *storedState) EnsureConstraints(constraints map[string]string) error {
+	return nil
+}
+
+func (f *storedState) EnsureIndexes(indexes map[string]string) error {
+	return nil
+}
+
+func TestLocksAreTakenTogetherOrNotAtAll(t *testing.T) {
+	assert := assert.New(t)
+
+	locks := newUUIDLocks()
+	unlock, err := locks.tryLock([]string{org1UUID, org2UUID, org1UUID})
+	assert.NoError(err)
+
+	_, err = locks.tryLock([]string{org3UUID, org2UUID})
+	if assert.IsType(concurrentWriteError{}, err) {
+		assert.Contains(err.(concurrentWriteError).ConcurrentWriteDetails(), org2UUID)
+	}
+
+	unlockOther, err := locks.tryLock([]string{org3UUID})
+	assert.NoError(err, "a failed lock should not leave any of its uuids locked")
+	unlockOther()
+
+	unlock()
+	unlock()
+	unlock, err = locks.tryLock([]string{org2UUID})
+	assert.NoError(err)
+	unlock()
+}
+
+func TestWriteRefusedWhileAnotherHoldsAnAlternativeUUID(t *testing.T) {
+	assert := assert.New(t)
+
+	unlock, err := writeLocks.tryLock([]string{org2UUID})
+	assert.NoError(err)
+	defer unlock()
+
+	rec := serveOrganisationsRequestWithBody("PUT", "/organisations/"+org1UUID,
+		`{"uuid":"`+org1UUID+`","type":"Organisation","alternativeIdentifiers":{"uuids":["`+org1UUID+`","`+org2UUID+`"]}}`)
+
+	assert.Equal(http.StatusConflict, rec.Code)
+	assert.Equal("1", rec.Header().Get("Retry-After"))
+	assert.Contains(rec.Body.String(), org2UUID)
+}
+
+func TestWriteRefusedWhileAnotherHoldsItsParent(t *testing.T) {
+	assert := assert.New(t)
+
+	unlock, err := writeLocks.tryLock([]string{org2UUID})
+	assert.NoError(err)
+	defer unlock()
+
+	rec := serveOrganisationsRequestWithBody("PUT", "/organisations/"+org1UUID,
+		`{"uuid":"`+org1UUID+`","type":"Organisation","parentOrganisation":"`+org2UUID+`"}`)
+
+	assert.Equal(http.StatusConflict, rec.Code)
+	assert.Contains(rec.Body.String(), org2UUID)
+}
+
+func TestBulkWriteRejectsLinesAnotherWriteHolds(t *testing.T) {
+	assert := assert.New(t)
+
+	unlock, err := writeLocks.tryLock([]string{org1UUID})
+	assert.NoError(err)
+	defer unlock()
+
+	rec := serveOrganisationsRequestWithBody("POST", "/organisations/__bulk", `{"uuid":"`+org1UUID+`","type":"Organisation"}`+"\n")
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"rejected":1`)
+	assert.Contains(rec.Body.String(), "Another write is in progress for "+org1UUID)
+}
+
+func TestWriteLocksAreSharedWithOtherInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	locks := &sharedWriteLocks{owners: map[string]string{org2UUID: "another instance"}}
+	cd := NewCypherOrganisationService(nil, Config{LockRunner: locks})
+
+	_, err := cd.lockUUIDs([]string{org1UUID, org2UUID})
+	if assert.IsType(concurrentWriteError{}, err) {
+		assert.Contains(err.(concurrentWriteError).ConcurrentWriteDetails(), org2UUID)
+		assert.NotContains(err.(concurrentWriteError).ConcurrentWriteDetails(), org1UUID)
+	}
+	assert.Equal(map[string]string{org2UUID: "another instance"}, locks.owners, "a failed lock should release the uuids it took")
+
+	lock, err := cd.lockUUIDs([]string{org1UUID})
+	assert.NoError(err, "a failed lock should not leave any of its uuids locked in this instance")
+	assert.Contains(locks.owners, org1UUID)
+
+	cd.unlock(lock)
+	cd.unlock(lock)
+	assert.Equal(map[string]string{org2UUID: "another instance"}, locks.owners)
+}
+
+func TestWriteLocksAreOnlySharedWhenTheWriteDependsOnTheStoredState(t *testing.T) {
+	assert := assert.New(t)
+
+	revision := 1
+	for name, test := range map[string]struct {
+		parent string
+		state  writeState
+		opts   writeOptions
+		shared bool
+	}{
+		"no old nodes":      {state: writeState{Exists: true, Revision: 1}},
+		"old nodes":         {state: writeState{Exists: true, Revision: 1, OldNodes: 1}, shared: true},
+		"expected revision": {state: writeState{Exists: true, Revision: 1}, opts: writeOptions{IfMatchRevision: &revision}, shared: true},
+		"any revision":      {state: writeState{Exists: true, Revision: 1}, opts: writeOptions{IfMatchAny: true}, shared: true},
+		"same parent":       {parent: org3UUID, state: writeState{Exists: true, Revision: 1, Parent: org3UUID}},
+		"new parent":        {parent: org3UUID, state: writeState{Exists: true, Revision: 1}, shared: true},
+	} {
+		o := organisation{UUID: org1UUID, ParentOrganisation: test.parent, AlternativeIdentifiers: alternativeIdentifiers{UUIDS: []string{org1UUID, org2UUID}}}
+		db := &storedState{state: test.state}
+		locks := &sharedWriteLocks{owners: map[string]string{}}
+		cd := NewCypherOrganisationService(db, Config{LockRunner: locks})
+
+		state, lock, err := cd.lockWrite(o, test.opts)
+		assert.NoError(err, name)
+		assert.Equal(test.state, state, name)
+		if test.shared {
+			for _, uuid := range writeUUIDs(o) {
+				assert.Equal(lock.owner, locks.owners[uuid], "%s: %s should be locked", name, uuid)
+			}
+			assert.Equal(2, db.reads, "%s: the state should be read again once the lock is shared", name)
+		} else {
+			assert.Equal(0, locks.transactions, "%s: the lock should not have been shared", name)
+			assert.Equal(1, db.reads, name)
+		}
+
+		cd.unlock(lock)
+		assert.Empty(locks.owners, name)
+		if test.shared {
+			assert.Equal(2, locks.transactions, "%s: the lock should be claimed and released once", name)
+		}
+	}
+}
+
+func TestBulkWriteReleasesSharedLocksTogether(t *testing.T) {
+	assert := assert.New(t)
+
+	locks := &sharedWriteLocks{owners: map[string]string{}}
+	cd := NewCypherOrganisationService(&storedState{state: writeState{OldNodes: 1}}, Config{LockRunner: locks})
+
+	w := &bulkWriter{cd: cd}
+	for _, uuid := range []string{org1UUID, org2UUID, org3UUID} {
+		_, lock, err := cd.lockWrite(organisation{UUID: uuid}, writeOptions{})
+		assert.NoError(err)
+		w.pending = append(w.pending, pendingBulkWrite{uuid: uuid, lock: lock})
+	}
+	assert.Len(locks.owners, 3)
+	assert.Equal(3, locks.transactions)
+
+	w.unlock()
+	assert.Empty(locks.owners)
+	assert.Equal(4, locks.transactions, "the locks should be released in one transaction")
+}
+
+func TestWriteLocksInNeo4jAreTakenByOneWriteAtATime(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	// the lock of a write to another instance
+	other := &writeLock{uuids: []string{org2UUID}, unlockInstance: func() {}}
+	assert.NoError(cypherDriver.share(other))
+	defer cypherDriver.unlock(other)
+
+	_, err := cypherDriver.lockUUIDs([]string{org1UUID, org2UUID})
+	assert.IsType(concurrentWriteError{}, err)
+
+	yetAnother := &writeLock{uuids: []string{org1UUID}, unlockInstance: func() {}}
+	assert.NoError(cypherDriver.share(yetAnother), "a failed lock should release the uuids it took")
+	cypherDriver.unlock(yetAnother)
+
+	cypherDriver.unlock(other)
+	lock, err := cypherDriver.lockUUIDs([]string{org1UUID, org2UUID})
+	assert.NoError(err)
+	cypherDriver.unlock(lock)
+}
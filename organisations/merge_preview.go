@@ -0,0 +1,142 @@
+package organisations
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/jmcvetta/neoism"
+)
+
+//PreviewMerge - Describes what concording the source node into the canonical organisation would do, without doing it:
+//the properties of the source which would be lost, the relationships which would move, and those which would collapse
+func (cd service) PreviewMerge(canonicalUUID string, sourceUUID string, transId string) (mergePreview, bool, error) {
+	canonical, _, found, err := cd.ReadWithRevision(canonicalUUID, transId)
+	if err != nil || !found {
+		return mergePreview{}, false, err
+	}
+
+	candidates, err := cd.readConcordanceCandidates(canonicalUUID, []string{sourceUUID})
+	if err != nil {
+		return mergePreview{}, false, err
+	}
+	sourceExists, err := candidates.exists(sourceUUID)
+	if err != nil || !sourceExists {
+		return mergePreview{}, false, err
+	}
+
+	preview := mergePreview{
+		Canonical:                 canonical,
+		Conflicts:                 []propertyConflict{},
+		PlatformVersionCollisions: []platformVersionCollision{},
+	}
+
+	if source := candidates.organisation(sourceUUID); source != nil {
+		preview.Source = source
+		merged := canonical
+		if cd.config.FoldSourceNames {
+			merged, _ = foldSourceNames(canonical, []plannedMerge{{SourceUUID: sourceUUID, Source: source}})
+		}
+		if preview.Conflicts, err = propertyConflicts(merged, *source); err != nil {
+			return mergePreview{}, true, err
+		}
+	}
+
+	relationshipsFromSource, relationshipsToSource := candidates.relationships.Relationships(sourceUUID)
+	edges := candidates.relationships.Edges(sourceUUID)
+	preview.Relationships, preview.DroppedRelationships, preview.BlockingRelationships = cd.config.concordedRelationships(relationshipsFromSource, relationshipsToSource, edges.Loops)
+	_, stats := cd.config.constructTransferRelationshipsQueries(canonicalUUID, sourceUUID, relationshipsFromSource, relationshipsToSource, edges)
+	preview.Loops, preview.Collapsed = concordedLoops(stats.Loops), stats.Collapsed
+
+	collisionsQuery := &neoism.CypherQuery{
+		Statement: `MATCH (s:Thing {uuid:{sourceUUID}})-[sr]->(p)<-[cr]-(c:Thing {uuid:{canonicalUUID}})
+					WHERE type(sr) = type(cr) AND EXISTS(sr.platformVersion) AND sr.platformVersion = cr.platformVersion
+					RETURN type(sr) as type, {outgoing} as direction, sr.platformVersion as platformVersion, p.uuid as otherUUID
+					UNION ALL
+					MATCH (s:Thing {uuid:{sourceUUID}})<-[sr]-(p)-[cr]->(c:Thing {uuid:{canonicalUUID}})
+					WHERE type(sr) = type(cr) AND EXISTS(sr.platformVersion) AND sr.platformVersion = cr.platformVersion
+					RETURN type(sr) as type, {incoming} as direction, sr.platformVersion as platformVersion, p.uuid as otherUUID`,
+		Parameters: map[string]interface{}{
+			"canonicalUUID": canonicalUUID,
+			"sourceUUID":    sourceUUID,
+			"outgoing":      outgoingDirection,
+			"incoming":      incomingDirection,
+		},
+		Result: &preview.PlatformVersionCollisions,
+	}
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{collisionsQuery}); err != nil {
+		return mergePreview{}, true, err
+	}
+
+	return preview, true, nil
+}
+
+// propertyConflicts finds the fields of the source organisation whose values the canonical one does not have.
+// The merge only keeps the properties of the canonical organisation, so these would be lost
+func propertyConflicts(canonical organisation, source organisation) ([]propertyConflict, error) {
+	canonicalFields, err := organisationFields(canonical)
+	if err != nil {
+		return nil, err
+	}
+	sourceFields, err := organisationFields(source)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range sourceFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	conflicts := []propertyConflict{}
+	for _, name := range names {
+		if name == "uuid" {
+			continue
+		}
+		sourceValue, canonicalValue := sourceFields[name], canonicalFields[name]
+
+		conflicting := false
+		if items, ok := sourceValue.([]interface{}); ok {
+			canonicalItems, _ := canonicalValue.([]interface{})
+			for _, item := range items {
+				if !containsItem(canonicalItems, item) {
+					conflicting = true
+				}
+			}
+		} else {
+			conflicting = sourceValue != "" && sourceValue != canonicalValue
+		}
+
+		if conflicting {
+			conflicts = append(conflicts, propertyConflict{Field: name, Canonical: canonicalValue, Source: sourceValue})
+		}
+	}
+	return conflicts, nil
+}
+
+// organisationFields flattens the JSON fields of an organisation, naming the alternative identifiers like alternativeIdentifiers.TME
+func organisationFields(o organisation) (map[string]interface{}, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	for name, value := range doc {
+		if nested, ok := value.(map[string]interface{}); ok {
+			for nestedName, nestedValue := range nested {
+				fields[fmt.Sprintf("%s.%s", name, nestedName)] = nestedValue
+			}
+			continue
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
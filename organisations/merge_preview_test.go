@@ -0,0 +1,40 @@
+package organisations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropertyConflictsListsSourceValuesTheCanonicalLacks(t *testing.T) {
+	assert := assert.New(t)
+
+	canonical := organisation{
+		UUID:       org1UUID,
+		Type:       Company,
+		ProperName: "Canonical Name",
+		AlternativeIdentifiers: alternativeIdentifiers{
+			UUIDS: []string{org1UUID, org2UUID},
+		},
+		Aliases: []string{"alias1", "alias2"},
+	}
+	source := organisation{
+		UUID:       org2UUID,
+		Type:       Company,
+		ProperName: "Source Name",
+		LegalName:  "Source Legal Name",
+		AlternativeIdentifiers: alternativeIdentifiers{
+			UUIDS: []string{org2UUID},
+			TME:   []string{tmeOrg2Identifier},
+		},
+		Aliases: []string{"alias2"},
+	}
+
+	conflicts, err := propertyConflicts(canonical, source)
+	assert.NoError(err)
+	assert.Equal([]propertyConflict{
+		{Field: "alternativeIdentifiers.TME", Canonical: nil, Source: []interface{}{tmeOrg2Identifier}},
+		{Field: "legalName", Canonical: nil, Source: "Source Legal Name"},
+		{Field: "properName", Canonical: "Canonical Name", Source: "Source Name"},
+	}, conflicts)
+}
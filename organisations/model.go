@@ -1,6 +1,10 @@
 package organisations
 
-import "errors"
+import (
+	"time"
+
+	"github.com/Financial-Times/organisations-rw-neo4j/transfer"
+)
 
 //OrgType is the type of an Organisation
 type OrgType string
@@ -20,6 +24,9 @@ type organisation struct {
 	Aliases                []string               `json:"aliases,omitempty"`
 	IndustryClassification string                 `json:"industryClassification,omitempty"`
 	ParentOrganisation     string                 `json:"parentOrganisation,omitempty"`
+	// UnknownLabels are the labels of the organisation read which belong to no type. They are diagnostics, not part of
+	// the organisation written
+	UnknownLabels []string `json:"-"`
 }
 
 type alternativeIdentifiers struct {
@@ -27,6 +34,132 @@ type alternativeIdentifiers struct {
 	UUIDS             []string `json:"uuids"`
 	FactsetIdentifier string   `json:"factsetIdentifier,omitempty"`
 	LeiCode           string   `json:"leiCode,omitempty"`
+	ISINs             []string `json:"isins,omitempty"`
+	SEDOLs            []string `json:"sedols,omitempty"`
+	CUSIPs            []string `json:"cusips,omitempty"`
+	// Tickers are exchange tickers, each scoped to the MIC of its exchange, like XNAS:AAPL
+	Tickers []string `json:"tickers,omitempty"`
+}
+
+// writeOptions changes how an organisation is written
+type writeOptions struct {
+	Force           bool
+	IfMatchRevision *int
+	// IfMatchAny only lets the write through if the organisation exists, whatever its revision
+	IfMatchAny bool
+	DryRun     bool
+}
+
+// writeResult reports the outcome of writing an organisation, or for a dry run, what the write would do
+type writeResult struct {
+	Changed  bool         `json:"changed"`
+	Revision int          `json:"-"`
+	DryRun   *writeDryRun `json:"dryRun,omitempty"`
+}
+
+// writeDryRun describes the queries a write would run and their effects
+type writeDryRun struct {
+	Summary []string       `json:"summary"`
+	Queries []plannedQuery `json:"queries"`
+}
+
+// plannedQuery is a query a dry run would have run
+type plannedQuery struct {
+	Statement  string                 `json:"statement"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// plannedMerge is an old node a write concords into the organisation, with the organisation it was, if any,
+// what happens to its relationships, and the names of it kept on the organisation
+type plannedMerge struct {
+	SourceUUID        string
+	Source            *organisation
+	Relationships     []movedRelationships
+	Dropped           []movedRelationships
+	Loops             []transfer.Loop
+	Collapsed         []transfer.Collapse
+	FoldedFormerNames []string
+	FoldedAliases     []string
+}
+
+// listFilter restricts the organisations returned by a listing; nil or empty fields do not filter
+type listFilter struct {
+	Type                      OrgType
+	IncludeSubtypes           bool
+	HasParent                 *bool
+	HasIndustryClassification *bool
+	PrefLabelPrefix           string
+}
+
+// hierarchyNode is an organisation in the SUB_ORGANISATION_OF hierarchy, at a depth relative to the organisation asked about
+type hierarchyNode struct {
+	UUID               string   `json:"uuid"`
+	PrefLabel          string   `json:"prefLabel,omitempty"`
+	Type               OrgType  `json:"type,omitempty"`
+	ParentOrganisation string   `json:"parentOrganisation,omitempty"`
+	Depth              int      `json:"depth"`
+	UnknownLabels      []string `json:"unknownLabels,omitempty"`
+}
+
+// concordanceAudit records the merge of an old organisation node into the canonical organisation
+type concordanceAudit struct {
+	CanonicalUUID string               `json:"canonicalUUID"`
+	SourceUUID    string               `json:"sourceUUID"`
+	TransactionID string               `json:"transactionId"`
+	Timestamp     time.Time            `json:"timestamp"`
+	Relationships []movedRelationships `json:"relationships"`
+	Source        *organisation        `json:"source,omitempty"`
+	Collapsed     []transfer.Collapse  `json:"collapsed"`
+}
+
+// movedRelationships counts the relationships of a type moved from the source node, in the direction they point from it
+type movedRelationships struct {
+	Type      string `json:"type"`
+	Direction string `json:"direction"`
+	Count     int    `json:"count"`
+}
+
+// unmergeResult reports what splitting a concorded organisation back out of the canonical one restored
+type unmergeResult struct {
+	CanonicalUUID       string               `json:"canonicalUUID"`
+	SourceUUID          string               `json:"sourceUUID"`
+	Relationships       []movedRelationships `json:"relationships"`
+	RetainedIdentifiers []identifierValue    `json:"retainedIdentifiers"`
+}
+
+// identifierValue is the value of an Identifier node of the given label
+type identifierValue struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// mergePreview describes what concording a source node into the canonical organisation would do
+type mergePreview struct {
+	Canonical                 organisation               `json:"canonical"`
+	Source                    *organisation              `json:"source"`
+	Conflicts                 []propertyConflict         `json:"conflicts"`
+	Relationships             []movedRelationships       `json:"relationships"`
+	DroppedRelationships      []movedRelationships       `json:"droppedRelationships"`
+	BlockingRelationships     []movedRelationships       `json:"blockingRelationships"`
+	Loops                     []transfer.Loop            `json:"loops"`
+	Collapsed                 []transfer.Collapse        `json:"collapsed"`
+	PlatformVersionCollisions []platformVersionCollision `json:"platformVersionCollisions"`
+}
+
+// propertyConflict is a field whose value on the source organisation would be lost by the merge
+type propertyConflict struct {
+	Field     string      `json:"field"`
+	Canonical interface{} `json:"canonical"`
+	Source    interface{} `json:"source"`
+}
+
+// platformVersionCollision is a relationship of the source node which the merge would collapse into one of the canonical
+// organisation, as both link the same node with the same type and platformVersion
+type platformVersionCollision struct {
+	Type            string `json:"type"`
+	Direction       string `json:"direction"`
+	PlatformVersion string `json:"platformVersion"`
+	OtherUUID       string `json:"otherUUID"`
 }
 
 const (
@@ -34,20 +167,37 @@ const (
 	uppIdentifierLabel     = "UPPIdentifier"
 	factsetIdentifierLabel = "FactsetIdentifier"
 	leiIdentifierLabel     = "LegalEntityIdentifier"
+	isinIdentifierLabel    = "ISINIdentifier"
+	sedolIdentifierLabel   = "SEDOLIdentifier"
+	cusipIdentifierLabel   = "CUSIPIdentifier"
+	tickerIdentifierLabel  = "TickerIdentifier"
 )
 
-func (o OrgType) String() (error, string) {
-
-	switch o {
-	case Organisation:
-		return nil, "Organisation:Concept:Thing"
-	case Company:
-		return nil, "Company:Organisation:Concept:Thing"
-	case PublicCompany:
-		return nil, "PublicCompany:Company:Organisation:Concept:Thing"
-	default:
-		return errors.New("This type is not supported yet. Only 'Organisation', 'Company' or 'PublicCompany' and these types must be allocated to a 'type' json property"), ""
-	}
+// identifierLabels maps the identifier types accepted by the lookup API to their Identifier node labels
+var identifierLabels = map[string]string{
+	"tme":     tmeIdentifierLabel,
+	"upp":     uppIdentifierLabel,
+	"factset": factsetIdentifierLabel,
+	"lei":     leiIdentifierLabel,
+	"isin":    isinIdentifierLabel,
+	"sedol":   sedolIdentifierLabel,
+	"cusip":   cusipIdentifierLabel,
+	"ticker":  tickerIdentifierLabel,
+}
+
+// marketIdentifier is a list of identifiers the markets data joins on, with the label of their Identifier nodes
+type marketIdentifier struct {
+	label string
+	field string
+	list  func(ids *alternativeIdentifiers) *[]string
+}
+
+// marketIdentifiers are read in one go, as an organisation may have many of each
+var marketIdentifiers = []marketIdentifier{
+	{isinIdentifierLabel, "isins", func(ids *alternativeIdentifiers) *[]string { return &ids.ISINs }},
+	{sedolIdentifierLabel, "sedols", func(ids *alternativeIdentifiers) *[]string { return &ids.SEDOLs }},
+	{cusipIdentifierLabel, "cusips", func(ids *alternativeIdentifiers) *[]string { return &ids.CUSIPs }},
+	{tickerIdentifierLabel, "tickers", func(ids *alternativeIdentifiers) *[]string { return &ids.Tickers }},
 }
 
 const (
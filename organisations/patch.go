@@ -0,0 +1,147 @@
+package organisations
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	listAddKey    = "add"
+	listRemoveKey = "remove"
+)
+
+// applyPatch applies a JSON Merge Patch (RFC 7396) to the organisation. On top of the standard semantics,
+// a list field such as aliases or alternativeIdentifiers.uuids can be patched with {"add": [...], "remove": [...]}
+// to add or remove single items instead of replacing the whole list
+func applyPatch(o organisation, patch map[string]interface{}) (organisation, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return organisation{}, err
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return organisation{}, err
+	}
+
+	if err := mergePatch(doc, patch, ""); err != nil {
+		return organisation{}, err
+	}
+
+	b, err = json.Marshal(doc)
+	if err != nil {
+		return organisation{}, err
+	}
+
+	patched := organisation{}
+	if err := json.Unmarshal(b, &patched); err != nil {
+		return organisation{}, requestError{fmt.Sprintf("Patched organisation is invalid: %s", err.Error())}
+	}
+
+	if patched.UUID != o.UUID {
+		return organisation{}, requestError{"The uuid of an organisation cannot be patched"}
+	}
+
+	return patched, nil
+}
+
+func mergePatch(target map[string]interface{}, patch map[string]interface{}, path string) error {
+	for key, value := range patch {
+		switch v := value.(type) {
+		case nil:
+			delete(target, key)
+		case map[string]interface{}:
+			if isListPatch(v) {
+				list, err := patchList(target[key], v, path+key)
+				if err != nil {
+					return err
+				}
+				target[key] = list
+				continue
+			}
+
+			sub, ok := target[key].(map[string]interface{})
+			if !ok {
+				sub = map[string]interface{}{}
+			}
+			if err := mergePatch(sub, v, path+key+"."); err != nil {
+				return err
+			}
+			target[key] = sub
+		default:
+			target[key] = v
+		}
+	}
+	return nil
+}
+
+func isListPatch(patch map[string]interface{}) bool {
+	if len(patch) == 0 {
+		return false
+	}
+	for key := range patch {
+		if key != listAddKey && key != listRemoveKey {
+			return false
+		}
+	}
+	return true
+}
+
+func patchList(current interface{}, patch map[string]interface{}, field string) ([]interface{}, error) {
+	list := []interface{}{}
+	if current != nil {
+		var ok bool
+		if list, ok = current.([]interface{}); !ok {
+			return nil, requestError{fmt.Sprintf("%s is not a list, so items cannot be added to or removed from it", field)}
+		}
+	}
+
+	toRemove, err := listPatchItems(patch, listRemoveKey, field)
+	if err != nil {
+		return nil, err
+	}
+	toAdd, err := listPatchItems(patch, listAddKey, field)
+	if err != nil {
+		return nil, err
+	}
+
+	patched := []interface{}{}
+	for _, item := range list {
+		if !containsItem(toRemove, item) {
+			patched = append(patched, item)
+		}
+	}
+	for _, item := range toAdd {
+		if !containsItem(patched, item) {
+			patched = append(patched, item)
+		}
+	}
+
+	return patched, nil
+}
+
+func listPatchItems(patch map[string]interface{}, key string, field string) ([]interface{}, error) {
+	value, ok := patch[key]
+	if !ok {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, requestError{fmt.Sprintf("%s.%s should be a list of strings", field, key)}
+	}
+	for _, item := range items {
+		if _, ok := item.(string); !ok {
+			return nil, requestError{fmt.Sprintf("%s.%s should be a list of strings", field, key)}
+		}
+	}
+	return items, nil
+}
+
+func containsItem(items []interface{}, item interface{}) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
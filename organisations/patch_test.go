@@ -0,0 +1,99 @@
+package organisations
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchUpdatesOnlyGivenProperties(t *testing.T) {
+	assert := assert.New(t)
+
+	patched, err := applyPatch(fullOrg, patchFromJSON(t, `{"legalName": "New Legal Name", "hiddenLabel": null}`))
+
+	expected := fullOrg
+	expected.LegalName = "New Legal Name"
+	expected.HiddenLabel = ""
+	assert.NoError(err)
+	assert.Equal(expected, patched)
+}
+
+func TestPatchReplacesListsGivenAsArrays(t *testing.T) {
+	assert := assert.New(t)
+
+	patched, err := applyPatch(fullOrg, patchFromJSON(t, `{"aliases": ["only alias"]}`))
+
+	assert.NoError(err)
+	assert.Equal([]string{"only alias"}, patched.Aliases)
+}
+
+func TestPatchAddsAndRemovesListItems(t *testing.T) {
+	assert := assert.New(t)
+
+	patched, err := applyPatch(fullOrg, patchFromJSON(t, `{
+		"aliases": {"add": ["alias4", "alias1"], "remove": ["alias2"]},
+		"tradeNames": {"remove": ["Old Trade Name, inc."]},
+		"localNames": {"remove": ["missing"]}}`))
+
+	assert.NoError(err)
+	assert.Equal([]string{"alias1", "alias3", "alias4"}, patched.Aliases)
+	assert.Equal([]string{"Older Trade Name, inc."}, patched.TradeNames)
+	assert.Equal(fullOrg.LocalNames, patched.LocalNames)
+}
+
+func TestPatchAddsToMissingList(t *testing.T) {
+	assert := assert.New(t)
+
+	patched, err := applyPatch(minimalOrg, patchFromJSON(t, `{"formerNames": {"add": ["Former Name"]}}`))
+
+	assert.NoError(err)
+	assert.Equal([]string{"Former Name"}, patched.FormerNames)
+}
+
+func TestPatchChangesSingleAlternativeIdentifiers(t *testing.T) {
+	assert := assert.New(t)
+
+	patched, err := applyPatch(fullOrg, patchFromJSON(t, `{"alternativeIdentifiers": {
+		"TME": {"add": ["tmeIdentifierNew"]},
+		"uuids": {"add": ["`+minimalOrgUUID+`"]},
+		"leiCode": null}}`))
+
+	expected := fullOrg.AlternativeIdentifiers
+	expected.TME = []string{tmeIdentifier, "tmeIdentifierNew"}
+	expected.UUIDS = []string{fullOrgUUID, minimalOrgUUID}
+	expected.LeiCode = ""
+	assert.NoError(err)
+	assert.Equal(expected, patched.AlternativeIdentifiers)
+	assert.Equal(fullOrg.ProperName, patched.ProperName)
+}
+
+func TestPatchRejectsUUIDChange(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := applyPatch(fullOrg, patchFromJSON(t, `{"uuid": "`+minimalOrgUUID+`"}`))
+
+	assert.IsType(requestError{}, err)
+}
+
+func TestPatchRejectsInvalidListPatches(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, patch := range []string{
+		`{"aliases": {"add": "alias4"}}`,
+		`{"aliases": {"add": [{}]}}`,
+		`{"properName": {"add": ["name"]}}`,
+		`{"aliases": "alias"}`,
+	} {
+		_, err := applyPatch(fullOrg, patchFromJSON(t, patch))
+		assert.IsType(requestError{}, err, patch)
+	}
+}
+
+func patchFromJSON(t *testing.T, patchJSON string) map[string]interface{} {
+	patch := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(patchJSON), &patch); err != nil {
+		t.Fatal(err)
+	}
+	return patch
+}
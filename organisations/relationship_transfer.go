@@ -2,136 +2,139 @@ package organisations
 
 import (
 	"fmt"
-	"github.com/Financial-Times/neo-utils-go/neoutils"
+
+	"github.com/Financial-Times/organisations-rw-neo4j/transfer"
+	"github.com/Financial-Times/up-rw-app-api-go/rwapi"
 	"github.com/jmcvetta/neoism"
 )
 
-type relationships []struct {
-	RelationshipType string `json:"relationship"`
-}
+type relationships []transfer.RelationshipCount
 
-// TransferRelationships is responsible for moving relationships from node with sourceUUID to node with destinationUUID
-func CreateTransferRelationshipsQueries(cypherRunner neoutils.CypherRunner, destinationUUID string, sourceUUID string) ([]*neoism.CypherQuery, error) {
+// writerRelationships are the relationship types this writer owns. Those still on a node being concorded, the redirects
+// of nodes concorded into it earlier and the parent relationships of its children, are always moved to the canonical
+// organisation, whatever the deployment configures, as dropping them would break redirects and hierarchies
+var writerRelationships = []string{"REDIRECTS_TO", "SUB_ORGANISATION_OF", "IDENTIFIES", "HAS_CLASSIFICATION"}
 
-	relationshipsFromSourceNode, relationshipsToSourceNode, err := getNodeRelationshipNames(cypherRunner, sourceUUID)
-	if err != nil {
-		return nil, err
+// relationshipTransfer moves relationships between Things, telling annotations apart by platformVersion. Moved relationships
+// are marked as concordedFrom the node they were first moved from, so they can be moved back. Only the types the deployment
+// transfers are moved, along with those the writer owns
+func (c Config) relationshipTransfer() transfer.Transferer {
+	allow := []string{}
+	if len(c.TransferredRelationships) > 0 {
+		allow = append(append(allow, c.TransferredRelationships...), writerRelationships...)
 	}
-
-	writeQueries := []*neoism.CypherQuery{}
-	for _, rel := range relationshipsFromSourceNode {
-		transfQuery := constructTransferRelationshipsWithPlatformVersionFromNodeQuery(sourceUUID, destinationUUID, rel.RelationshipType)
-		transfQuery2 := constructTransferRelationshipsFromNodeQuery(sourceUUID, destinationUUID, rel.RelationshipType)
-		writeQueries = append(writeQueries, transfQuery, transfQuery2)
+	deny := []string{}
+	for _, relationshipType := range append(append([]string{}, c.DroppedRelationships...), c.BlockingRelationships...) {
+		if !containsString(writerRelationships, relationshipType) {
+			deny = append(deny, relationshipType)
+		}
 	}
 
-	for _, rel := range relationshipsToSourceNode {
-		transfQuery := constructTransferRelationshipsWithPlatformVersionToNodeQuery(sourceUUID, destinationUUID, rel.RelationshipType)
-		transfQuery2 := constructTransferRelationshipsToNodeQuery(sourceUUID, destinationUUID, rel.RelationshipType)
-		writeQueries = append(writeQueries, transfQuery, transfQuery2)
-	}
+	return transfer.New(transfer.Config{
+		Label:          "Thing",
+		Discriminators: []string{"platformVersion"},
+		Allow:          allow,
+		Deny:           deny,
+		SourceProperty: "concordedFrom",
+		RepointedLoops: c.RepointedLoopRelationships,
+	})
+}
 
-	return writeQueries, nil
+// blocks tells whether relationships of the type stop a node being concorded
+func (c Config) blocks(relationshipType string) bool {
+	return containsString(c.BlockingRelationships, relationshipType) && !containsString(writerRelationships, relationshipType)
 }
 
-func getNodeRelationshipNames(cypherRunner neoutils.CypherRunner, uuid string) (relationshipsFromNodeWithUUID relationships, relationshipsToNodeWithUUID relationships, err error) {
-	// find all the -> relationships
-	relationshipsFromNodeWithUUID = relationships{}
-	readRelationshipsFromNodeWithUUIDQuery := &neoism.CypherQuery{
-		Statement: `match (a:Thing{uuid:{uuid}})-[r]->(b)
-			    return distinct type(r) as relationship`,
-		Parameters: map[string]interface{}{
-			"uuid": uuid,
-		},
-		Result: &relationshipsFromNodeWithUUID,
+// concordedRelationships splits the relationships a merge takes from the old node into those moved to the canonical
+// organisation, those dropped with the old node, and those of types which block concordance. Relationships between
+// the two nodes are not moved, but block concordance all the same
+func (c Config) concordedRelationships(relationshipsFromNode relationships, relationshipsToNode relationships, loops []transfer.Loop) (moved []movedRelationships, dropped []movedRelationships, blocking []movedRelationships) {
+	transferer := c.relationshipTransfer()
+
+	moved, dropped, blocking = []movedRelationships{}, []movedRelationships{}, []movedRelationships{}
+	for _, rel := range movedRelationshipsOf(relationshipsFromNode, relationshipsToNode) {
+		if c.blocks(rel.Type) {
+			blocking = append(blocking, rel)
+		}
 	}
 
-	// find all the <- relationships
-	relationshipsToNodeWithUUID = relationships{}
-	readRelationshipsToNodeWithUUIDQuery := &neoism.CypherQuery{
-		Statement: `match (a:Thing{uuid:{uuid}})<-[r]-(b)
-			    return distinct type(r) as relationship`,
-		Parameters: map[string]interface{}{
-			"uuid": uuid,
-		},
-		Result: &relationshipsToNodeWithUUID,
+	relationshipsFromNode, relationshipsToNode = transfer.WithoutLoops(relationshipsFromNode, relationshipsToNode, loops)
+	for _, rel := range movedRelationshipsOf(relationshipsFromNode, relationshipsToNode) {
+		switch {
+		case c.blocks(rel.Type):
+		case transferer.Moves(rel.Type):
+			moved = append(moved, rel)
+		default:
+			dropped = append(dropped, rel)
+		}
 	}
+	return moved, dropped, blocking
+}
 
-	readQueries := []*neoism.CypherQuery{readRelationshipsFromNodeWithUUIDQuery, readRelationshipsToNodeWithUUIDQuery}
-
-	err = cypherRunner.CypherBatch(readQueries)
+// concordedLoops leaves out of the loops between the old node and the canonical organisation those deleted before
+// the transfer by constructDeleteEntityRelationshipQuery
+func concordedLoops(loops []transfer.Loop) []transfer.Loop {
+	concorded := []transfer.Loop{}
+	for _, loop := range loops {
+		if isEntityRelationship(loop.Type, loop.Direction) {
+			continue
+		}
+		concorded = append(concorded, loop)
+	}
+	return concorded
+}
 
-	if err != nil {
-		return nil, nil, err
+func blockedConcordanceError(canonicalUUID string, sourceUUID string, blocking []movedRelationships) error {
+	return rwapi.ConstraintOrTransactionError{
+		Message: fmt.Sprintf("Node %s cannot be concorded into %s, as it has %s, which block concordance",
+			sourceUUID, canonicalUUID, describeMovedRelationships(blocking)),
 	}
+}
 
-	return relationshipsFromNodeWithUUID, relationshipsToNodeWithUUID, nil
+// createTransferRelationshipsQueries moves the relationships the deployment transfers from node with sourceUUID to node with destinationUUID
+func (cd service) createTransferRelationshipsQueries(destinationUUID string, sourceUUID string) ([]*neoism.CypherQuery, error) {
+	queries, _, err := cd.config.relationshipTransfer().Plan(cd.conn, destinationUUID, sourceUUID)
+	return queries, err
 }
 
-func constructTransferRelationshipsWithPlatformVersionFromNodeQuery(fromUUID string, toUUID string, predicate string) *neoism.CypherQuery {
-	transferAnnotationsQuery := &neoism.CypherQuery{
-		Statement: fmt.Sprintf(`MATCH (oldNode:Thing {uuid:{fromUUID}})-[oldRel:%s]->(p)
-					WHERE EXISTS(oldRel.platformVersion)
-					MATCH (newNode:Thing {uuid:{toUUID}})
-					MERGE (newNode)-[newRel:%s{platformVersion:oldRel.platformVersion}]->(p)
-					on create SET newRel = oldRel
-					DELETE oldRel`, predicate, predicate),
-
-		Parameters: map[string]interface{}{
-			"fromUUID": fromUUID,
-			"toUUID":   toUUID,
-		},
-	}
-	return transferAnnotationsQuery
+// constructTransferRelationshipsQueries moves the relationships of the given types from node with sourceUUID to node with destinationUUID,
+// returning the stats of the transfer along with the queries
+func (c Config) constructTransferRelationshipsQueries(destinationUUID string, sourceUUID string, relationshipsFromSourceNode relationships, relationshipsToSourceNode relationships, edges transfer.Edges) ([]*neoism.CypherQuery, transfer.Stats) {
+	return c.relationshipTransfer().Queries(destinationUUID, sourceUUID, relationshipsFromSourceNode, relationshipsToSourceNode, edges)
 }
 
-func constructTransferRelationshipsFromNodeQuery(fromUUID string, toUUID string, predicate string) *neoism.CypherQuery {
-	transferAnnotationsQuery := &neoism.CypherQuery{
-		Statement: fmt.Sprintf(`MATCH (oldNode:Thing {uuid:{fromUUID}})-[oldRel:%s]->(p)
-					WHERE NOT EXISTS(oldRel.platformVersion)
-					MATCH (newNode:Thing {uuid:{toUUID}})
-					MERGE (newNode)-[newRel:%s]->(p)
-					on create SET newRel = oldRel
-					DELETE oldRel`, predicate, predicate),
-
-		Parameters: map[string]interface{}{
-			"fromUUID": fromUUID,
-			"toUUID":   toUUID,
-		},
+// constructDropRelationshipsQueries deletes the relationships of the given types from the node
+func constructDropRelationshipsQueries(uuid string, dropped []movedRelationships) []*neoism.CypherQuery {
+	queries := []*neoism.CypherQuery{}
+	for _, rel := range dropped {
+		pattern := "(o:Thing {uuid:{uuid}})-[r:%s]->()"
+		if rel.Direction == incomingDirection {
+			pattern = "(o:Thing {uuid:{uuid}})<-[r:%s]-()"
+		}
+		queries = append(queries, &neoism.CypherQuery{
+			Statement: fmt.Sprintf(`MATCH `+pattern+`
+					DELETE r`, rel.Type),
+			Parameters: map[string]interface{}{
+				"uuid": uuid,
+			},
+		})
 	}
-	return transferAnnotationsQuery
+	return queries
 }
 
-func constructTransferRelationshipsWithPlatformVersionToNodeQuery(fromUUID string, toUUID string, predicate string) *neoism.CypherQuery {
-	transferAnnotationsQuery := &neoism.CypherQuery{
-		Statement: fmt.Sprintf(`MATCH (oldNode:Thing {uuid:{fromUUID}})<-[oldRel:%s]-(p)
-					WHERE EXISTS(oldRel.platformVersion)
-					MATCH (newNode:Thing {uuid:{toUUID}})
-					MERGE (newNode)<-[newRel:%s{platformVersion:oldRel.platformVersion}]-(p)
-					ON create SET newRel = oldRel
-					DELETE oldRel`, predicate, predicate),
-
-		Parameters: map[string]interface{}{
-			"fromUUID": fromUUID,
-			"toUUID":   toUUID,
-		},
+func (cd service) getNodeRelationshipNames(uuid string) (relationshipsFromNodeWithUUID relationships, relationshipsToNodeWithUUID relationships, err error) {
+	from, to, err := cd.config.relationshipTransfer().Read(cd.conn, uuid)
+	if err != nil {
+		return nil, nil, err
 	}
-	return transferAnnotationsQuery
+	return from, to, nil
 }
 
-func constructTransferRelationshipsToNodeQuery(fromUUID string, toUUID string, predicate string) *neoism.CypherQuery {
-	transferAnnotationsQuery := &neoism.CypherQuery{
-		Statement: fmt.Sprintf(`MATCH (oldNode:Thing {uuid:{fromUUID}})<-[oldRel:%s]-(p)
-					WHERE not EXISTS(oldRel.platformVersion)
-					MATCH (newNode:Thing {uuid:{toUUID}})
-					MERGE (newNode)<-[newRel:%s]-(p)
-					ON CREATE SET newRel = oldRel
-					DELETE oldRel`, predicate, predicate),
-
-		Parameters: map[string]interface{}{
-			"fromUUID": fromUUID,
-			"toUUID":   toUUID,
-		},
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
 	}
-	return transferAnnotationsQuery
+	return false
 }
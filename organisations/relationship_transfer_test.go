@@ -3,6 +3,8 @@ package organisations
 import (
 	"fmt"
 	"github.com/Financial-Times/neo-utils-go/neoutils"
+	"github.com/Financial-Times/organisations-rw-neo4j/transfer"
+	"github.com/Financial-Times/up-rw-app-api-go/rwapi"
 	"github.com/jmcvetta/neoism"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -62,7 +64,7 @@ func TestGetNodeRelationshipNames(t *testing.T) {
 	assert.NoError(cypherDriver.Write(transferOrg1, "TEST_TRANS_ID"))
 	assert.NoError(cypherDriver.conn.CypherBatch([]*neoism.CypherQuery{addMentionsQuery}))
 
-	relationshipsFromNodeWithUUID, relationshipsToNodeWithUUID, err := getNodeRelationshipNames(cypherDriver.conn, transferOrg1UUID)
+	relationshipsFromNodeWithUUID, relationshipsToNodeWithUUID, err := cypherDriver.getNodeRelationshipNames(transferOrg1UUID)
 
 	assert.NoError(err)
 	assert.True(len(relationshipsFromNodeWithUUID) >= 1, "Expected -> relationship length differs from actual length")
@@ -93,20 +95,20 @@ func TestTransferRelationships(t *testing.T) {
 
 	//write new node and test that it doesn't yet have the relationships
 	assert.NoError(cypherDriver.Write(transferOrg2, "TEST_TRANS_ID"))
-	relationshipsFromNewNode, relationshipsToNewNode, err := getNodeRelationshipNames(cypherDriver.conn, transferOrg2UUID)
+	relationshipsFromNewNode, relationshipsToNewNode, err := cypherDriver.getNodeRelationshipNames(transferOrg2UUID)
 	assert.NoError(err)
 	assert.False(contains(relationshipsFromNewNode, testRelationshipRightToLeft))
 	assert.False(contains(relationshipsToNewNode, testRelationshipRightToLeft))
 
 	//transfer relationships from the one above to the on other uuid
-	transferQuery, err := CreateTransferRelationshipsQueries(cypherDriver.conn, transferOrg2UUID, transferOrg1UUID)
+	transferQuery, err := cypherDriver.createTransferRelationshipsQueries(transferOrg2UUID, transferOrg1UUID)
 	assert.NoError(err)
 	assert.NoError(cypherDriver.conn.CypherBatch(transferQuery))
 
 	//verify that the relationships has been transferred
-	relationshipsFromOldNode, relationshipsToOldNode, err := getNodeRelationshipNames(cypherDriver.conn, transferOrg1UUID)
+	relationshipsFromOldNode, relationshipsToOldNode, err := cypherDriver.getNodeRelationshipNames(transferOrg1UUID)
 	assert.NoError(err)
-	relationshipsFromNewNode, relationshipsToNewNode, err = getNodeRelationshipNames(cypherDriver.conn, transferOrg2UUID)
+	relationshipsFromNewNode, relationshipsToNewNode, err = cypherDriver.getNodeRelationshipNames(transferOrg2UUID)
 	assert.NoError(err)
 
 	//no relationships for the old node
@@ -137,6 +139,184 @@ func TestTransferRelationships(t *testing.T) {
 	assert.Equal("someValue", transferredProperty[0].Value)
 }
 
+func TestChainedConcordanceRedirectsWithAnAllowList(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := NewCypherOrganisationService(db, Config{BatchSize: 1024, TransferredRelationships: []string{"MENTIONS"}})
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org9, "TEST_TRANS_ID"))
+
+	org9Updated := org9
+	org9Updated.AlternativeIdentifiers.UUIDS = []string{org9UUID, org2UUID}
+	assert.NoError(cypherDriver.Write(org9Updated, "TEST_TRANS_ID"))
+
+	org1Updated := org1
+	org1Updated.AlternativeIdentifiers.UUIDS = []string{org1UUID, org9UUID}
+	assert.NoError(cypherDriver.Write(org1Updated, "TEST_TRANS_ID"))
+
+	for _, uuid := range []string{org2UUID, org9UUID} {
+		canonicalUUID, redirected, err := cypherDriver.ReadRedirect(uuid, "TEST_TRANS_ID")
+		assert.NoError(err)
+		assert.True(redirected, "%s should redirect", uuid)
+		assert.Equal(org1UUID, canonicalUUID)
+	}
+}
+
+func TestConcordingDropsAndBlocksConfiguredRelationships(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, transferUUIDsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanRelationshipDB(db, t, assert, transferUUIDsToClean)
+
+	addMentionsQuery := &neoism.CypherQuery{
+		Statement: `MATCH (c:Thing{uuid:{uuid}})
+			    CREATE (co:Content{uuid:{cuuid}})
+			    CREATE (co)-[:` + testRelationshipLeftToRight + `]->(c)
+			    CREATE (co)<-[:` + testRelationshipRightToLeft + `]-(c)`,
+		Parameters: map[string]interface{}{
+			"cuuid": relationShipTransferContentUUID,
+			"uuid":  transferOrg1UUID,
+		},
+	}
+	assert.NoError(cypherDriver.Write(transferOrg1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.conn.CypherBatch([]*neoism.CypherQuery{addMentionsQuery}))
+
+	concordingOrg2 := transferOrg2
+	concordingOrg2.AlternativeIdentifiers.UUIDS = []string{transferOrg2UUID, transferOrg1UUID}
+
+	blockingDriver := NewCypherOrganisationService(db, Config{BatchSize: 1024, BlockingRelationships: []string{testRelationshipLeftToRight}})
+	err := blockingDriver.Write(concordingOrg2, "TEST_TRANS_ID")
+	if assert.IsType(rwapi.ConstraintOrTransactionError{}, err) {
+		assert.Contains(err.Error(), "1 incoming "+testRelationshipLeftToRight)
+	}
+	_, found, err := cypherDriver.Read(transferOrg1UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found, "a blocked concordance should leave the old organisation in place")
+
+	droppingDriver := NewCypherOrganisationService(db, Config{BatchSize: 1024, DroppedRelationships: []string{testRelationshipLeftToRight}})
+	assert.NoError(droppingDriver.Write(concordingOrg2, "TEST_TRANS_ID"))
+
+	relationshipsFromNewNode, relationshipsToNewNode, err := cypherDriver.getNodeRelationshipNames(transferOrg2UUID)
+	assert.NoError(err)
+	assert.True(contains(relationshipsFromNewNode, testRelationshipRightToLeft))
+	assert.False(contains(relationshipsToNewNode, testRelationshipLeftToRight))
+}
+
+func TestConcordingDropsLoopsAndRecordsCollapses(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, transferUUIDsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanRelationshipDB(db, t, assert, transferUUIDsToClean)
+
+	assert.NoError(cypherDriver.Write(transferOrg1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(transferOrg2, "TEST_TRANS_ID"))
+
+	addRelationshipsQuery := &neoism.CypherQuery{
+		Statement: `MATCH (o1:Thing{uuid:{uuid1}}), (o2:Thing{uuid:{uuid2}})
+			    CREATE (co:Content{uuid:{cuuid}})
+			    CREATE (o1)-[:` + testRelationshipLeftToRight + `]->(o2)
+			    CREATE (co)-[:` + testRelationshipRightToLeft + `{someProperty:"old"}]->(o1)
+			    CREATE (co)-[:` + testRelationshipRightToLeft + `{someProperty:"new"}]->(o2)`,
+		Parameters: map[string]interface{}{
+			"cuuid": relationShipTransferContentUUID,
+			"uuid1": transferOrg1UUID,
+			"uuid2": transferOrg2UUID,
+		},
+	}
+	assert.NoError(cypherDriver.conn.CypherBatch([]*neoism.CypherQuery{addRelationshipsQuery}))
+
+	concordingOrg2 := transferOrg2
+	concordingOrg2.AlternativeIdentifiers.UUIDS = []string{transferOrg2UUID, transferOrg1UUID}
+	assert.NoError(cypherDriver.Write(concordingOrg2, "TEST_TRANS_ID"))
+
+	relationshipsFromNewNode, _, err := cypherDriver.getNodeRelationshipNames(transferOrg2UUID)
+	assert.NoError(err)
+	assert.False(contains(relationshipsFromNewNode, testRelationshipLeftToRight), "the relationship between the nodes should be dropped, not left as a loop")
+
+	audits, err := cypherDriver.ConcordanceAudits(transferOrg1UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	if assert.Len(audits, 1) {
+		assert.Equal([]transfer.Collapse{{
+			Type:           testRelationshipRightToLeft,
+			Direction:      incomingDirection,
+			OtherUUID:      relationShipTransferContentUUID,
+			LostProperties: map[string]interface{}{"someProperty": "old"},
+		}}, audits[0].Collapsed)
+	}
+}
+
+func TestConcordedRelationshipsFollowTheDeploymentConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	relationshipsFromNode := relationships{
+		{RelationshipType: "HAS_CLASSIFICATION", Count: 1},
+		{RelationshipType: "HAS_ROLE", Count: 2},
+	}
+	relationshipsToNode := relationships{
+		{RelationshipType: "MENTIONS", Count: 7},
+		{RelationshipType: "ABOUT", Count: 1},
+		{RelationshipType: "IS_PRIMARILY_CLASSIFIED_BY", Count: 4},
+	}
+
+	config := Config{
+		TransferredRelationships: []string{"MENTIONS", "HAS_ROLE"},
+		DroppedRelationships:     []string{"HAS_ROLE"},
+		BlockingRelationships:    []string{"IS_PRIMARILY_CLASSIFIED_BY"},
+	}
+	moved, dropped, blocking := config.concordedRelationships(relationshipsFromNode, relationshipsToNode, nil)
+
+	assert.Equal([]movedRelationships{{Type: "MENTIONS", Direction: incomingDirection, Count: 7}}, moved)
+	assert.Equal([]movedRelationships{
+		{Type: "HAS_ROLE", Direction: outgoingDirection, Count: 2},
+		{Type: "ABOUT", Direction: incomingDirection, Count: 1},
+	}, dropped)
+	assert.Equal([]movedRelationships{{Type: "IS_PRIMARILY_CLASSIFIED_BY", Direction: incomingDirection, Count: 4}}, blocking)
+
+	moved, dropped, blocking = Config{}.concordedRelationships(relationshipsFromNode, relationshipsToNode, nil)
+	assert.Len(moved, 4)
+	assert.Empty(dropped)
+	assert.Empty(blocking)
+}
+
+func TestWriterRelationshipsAreMovedWhateverTheDeploymentConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	relationshipsToNode := relationships{
+		{RelationshipType: "MENTIONS", Count: 7},
+		{RelationshipType: "REDIRECTS_TO", Count: 2},
+		{RelationshipType: "SUB_ORGANISATION_OF", Count: 1},
+	}
+
+	for _, config := range []Config{
+		{TransferredRelationships: []string{"MENTIONS"}},
+		{DroppedRelationships: []string{"REDIRECTS_TO"}},
+		{BlockingRelationships: []string{"REDIRECTS_TO", "SUB_ORGANISATION_OF"}},
+	} {
+		moved, dropped, blocking := config.concordedRelationships(relationships{}, relationshipsToNode, nil)
+		assert.Contains(moved, movedRelationships{Type: "REDIRECTS_TO", Direction: incomingDirection, Count: 2}, "%+v", config)
+		assert.Contains(moved, movedRelationships{Type: "SUB_ORGANISATION_OF", Direction: incomingDirection, Count: 1}, "%+v", config)
+		assert.Empty(dropped, "%+v", config)
+		assert.Empty(blocking, "%+v", config)
+	}
+}
+
+func TestDropRelationshipsQueriesDeleteEachDirection(t *testing.T) {
+	assert := assert.New(t)
+
+	queries := constructDropRelationshipsQueries(transferOrg1UUID, []movedRelationships{
+		{Type: "HAS_ROLE", Direction: outgoingDirection, Count: 2},
+		{Type: "ABOUT", Direction: incomingDirection, Count: 1},
+	})
+
+	if assert.Len(queries, 2) {
+		assert.Contains(queries[0].Statement, "MATCH (o:Thing {uuid:{uuid}})-[r:HAS_ROLE]->()")
+		assert.Contains(queries[1].Statement, "MATCH (o:Thing {uuid:{uuid}})<-[r:ABOUT]-()")
+		assert.Equal(map[string]interface{}{"uuid": transferOrg1UUID}, queries[0].Parameters)
+	}
+}
+
 func cleanRelationshipDB(db neoutils.CypherRunner, t *testing.T, assert *assert.Assertions, uuidsToClean []string) {
 	cleanDB(db, t, assert, uuidsToClean)
 
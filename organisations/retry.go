@@ -0,0 +1,108 @@
+package organisations
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/up-rw-app-api-go/rwapi"
+	"github.com/jmcvetta/neoism"
+	metrics "github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxWriteRetryBackoff caps the wait before a retry, however many there have been
+const maxWriteRetryBackoff = 10 * time.Second
+
+// transientErrorMarkers are found in the messages of Neo4j errors which are worth retrying. The transactional runner
+// of neoutils keeps only the messages of the failed queries, dropping their Neo4j codes, so errors are told apart by
+// message: those of the deadlocks and lock waits bulk loads run into, and the exception of a deadlock reported outside
+// a transaction
+var transientErrorMarkers = []string{
+	"can't acquire",
+	"can't wait on resource",
+	"DeadlockDetected",
+}
+
+var (
+	writeRetries        = metrics.GetOrRegisterCounter("organisations.write.retries", metrics.DefaultRegistry)
+	writeRetryRecovered = metrics.GetOrRegisterCounter("organisations.write.retry.recovered", metrics.DefaultRegistry)
+	writeRetryExhausted = metrics.GetOrRegisterCounter("organisations.write.retry.exhausted", metrics.DefaultRegistry)
+	writeRetryFailed    = metrics.GetOrRegisterCounter("organisations.write.retry.failed", metrics.DefaultRegistry)
+)
+
+// sleep waits between retries, and is replaced in tests
+var sleep = time.Sleep
+
+// writeBatch runs the queries of a write in one transaction, retrying it when it fails with a transient error,
+// up to the configured number of retries. A failed transaction is rolled back, so it can be run again as it is
+func (cd service) writeBatch(queries []*neoism.CypherQuery) error {
+	for retry := 0; ; retry++ {
+		err := cd.conn.CypherBatch(queries)
+		switch {
+		case err == nil:
+			if retry > 0 {
+				writeRetryRecovered.Inc(1)
+			}
+			return nil
+		case !isTransientError(err):
+			if retry > 0 {
+				writeRetryFailed.Inc(1)
+			}
+			return err
+		case retry >= cd.config.WriteRetries:
+			if retry > 0 {
+				writeRetryExhausted.Inc(1)
+			}
+			return err
+		}
+
+		backoff := writeRetryBackoff(cd.config.WriteRetryBackoff, retry)
+		log.Warnf("Retrying write after transient Neo4j error in %v (retry %d of %d): %v", backoff, retry+1, cd.config.WriteRetries, err)
+		writeRetries.Inc(1)
+		sleep(backoff)
+	}
+}
+
+// writeRetryBackoff doubles the base wait with every retry, and picks a random wait between half and all of that,
+// so writes which failed together do not retry together
+func writeRetryBackoff(base time.Duration, retry int) time.Duration {
+	backoff := base
+	for i := 0; i < retry && backoff < maxWriteRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxWriteRetryBackoff {
+		backoff = maxWriteRetryBackoff
+	}
+	if backoff < 2 {
+		return backoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+}
+
+// isTransientError tells whether an error of a write may go away when the write is retried. Errors are transient when
+// one of their messages has a transientErrorMarker, so one Neo4j reports with an unknown message is not retried
+func isTransientError(err error) bool {
+	for _, message := range neoErrorMessages(err) {
+		for _, marker := range transientErrorMarkers {
+			if strings.Contains(message, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// neoErrorMessages returns the messages of an error reported by Neo4j, including those of the failed queries of a
+// transaction. There are none for other errors
+func neoErrorMessages(err error) []string {
+	switch e := err.(type) {
+	case rwapi.ConstraintOrTransactionError:
+		return append([]string{e.Message}, e.Details...)
+	case neoism.NeoError:
+		return []string{e.Exception, e.Message}
+	case *neoism.NeoError:
+		return []string{e.Exception, e.Message}
+	}
+	return nil
+}
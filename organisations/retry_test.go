@@ -0,0 +1,108 @@
+package organisations
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/up-rw-app-api-go/rwapi"
+	"github.com/jmcvetta/neoism"
+	"github.com/stretchr/testify/assert"
+)
+
+var deadlockError = rwapi.ConstraintOrTransactionError{
+	Message: "Error with a query inside a transaction.",
+	Details: []string{"ForsetiClient[3] can't acquire ExclusiveLock{owner=ForsetiClient[7]} on NODE(42), because holders of that lock are waiting for ForsetiClient[3]."},
+}
+
+// failingWrites fails the first batches it runs with the given errors
+type failingWrites struct {
+	errors  []error
+	batches int
+}
+
+func (f *failingWrites) CypherBatch(queries []*neoism.CypherQuery) error {
+	f.batches++
+	if f.batches <= len(f.errors) {
+		return f.errors[f.batches-1]
+	}
+	return nil
+}
+
+func (f *failingWrites) EnsureConstraints(constraints map[string]string) error {
+	return nil
+}
+
+func (f *failingWrites) EnsureIndexes(indexes map[string]string) error {
+	return nil
+}
+
+func TestTransientErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isTransientError(deadlockError))
+	assert.True(isTransientError(neoism.NeoError{Exception: "DeadlockDetectedException"}))
+	assert.True(isTransientError(rwapi.ConstraintOrTransactionError{
+		Message: "Error with a query inside a transaction.",
+		Details: []string{"LockClient[1284] can't wait on resource RWLock[NODE(42), hash=1735526742] since => LockClient[1284] <-[:HELD_BY]- RWLock[NODE(43), hash=1066263457] <-[:WAITING_FOR]- LockClient[1285] <-[:HELD_BY]- RWLock[NODE(42), hash=1735526742]"},
+	}))
+
+	assert.False(isTransientError(rwapi.ConstraintOrTransactionError{
+		Message: "Error with a query inside a transaction.",
+		Details: []string{"Node(42) already exists with label `Thing` and property `uuid` = '1'"},
+	}))
+	assert.False(isTransientError(rwapi.ConstraintOrTransactionError{Message: "Error with a query inside a transaction."}))
+	assert.False(isTransientError(errors.New("connection refused")))
+}
+
+func TestWriteBatchRetriesTransientErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	waits := []time.Duration{}
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	retries, recovered := writeRetries.Count(), writeRetryRecovered.Count()
+	db := &failingWrites{errors: []error{deadlockError, deadlockError}}
+	cd := NewCypherOrganisationService(db, Config{WriteRetries: 3, WriteRetryBackoff: 100 * time.Millisecond})
+
+	assert.NoError(cd.writeBatch([]*neoism.CypherQuery{}))
+	assert.Equal(3, db.batches)
+	assert.Equal(int64(2), writeRetries.Count()-retries)
+	assert.Equal(int64(1), writeRetryRecovered.Count()-recovered)
+	if assert.Len(waits, 2) {
+		assert.True(waits[0] >= 50*time.Millisecond && waits[0] < 100*time.Millisecond, "first wait %v", waits[0])
+		assert.True(waits[1] >= 100*time.Millisecond && waits[1] < 200*time.Millisecond, "second wait %v", waits[1])
+	}
+}
+
+func TestWriteBatchGivesUpAfterTheRetryLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	exhausted := writeRetryExhausted.Count()
+	db := &failingWrites{errors: []error{deadlockError, deadlockError, deadlockError}}
+	cd := NewCypherOrganisationService(db, Config{WriteRetries: 2})
+
+	assert.Equal(deadlockError, cd.writeBatch([]*neoism.CypherQuery{}))
+	assert.Equal(3, db.batches)
+	assert.Equal(int64(1), writeRetryExhausted.Count()-exhausted)
+}
+
+func TestWriteBatchDoesNotRetryPermanentErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	constraintError := rwapi.ConstraintOrTransactionError{Message: "Node 42 already exists with label Thing and property \"uuid\"=[1]"}
+	db := &failingWrites{errors: []error{constraintError}}
+	cd := NewCypherOrganisationService(db, Config{WriteRetries: 3})
+
+	assert.Equal(constraintError, cd.writeBatch([]*neoism.CypherQuery{}))
+	assert.Equal(1, db.batches)
+}
+
+func TestWriteRetryBackoffIsCapped(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Duration(0), writeRetryBackoff(0, 5))
+	backoff := writeRetryBackoff(time.Second, 20)
+	assert.True(backoff >= maxWriteRetryBackoff/2 && backoff < maxWriteRetryBackoff, "wait %v", backoff)
+}
@@ -4,24 +4,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/Financial-Times/neo-utils-go/neoutils"
+	"github.com/Financial-Times/up-rw-app-api-go/rwapi"
 	"github.com/jmcvetta/neoism"
 )
 
 type service struct {
-	conn neoutils.NeoConnection
+	conn   neoutils.NeoConnection
+	config Config
+}
+
+// Config holds the deployment specific settings of the service
+type Config struct {
+	// BatchSize is the maximum number of statements the bulk write runs in one transaction
+	BatchSize int
+	// TransferredRelationships lists the only relationship types moved from a node being concorded. When empty, all are moved
+	TransferredRelationships []string
+	// DroppedRelationships lists relationship types deleted with a node being concorded, instead of being moved
+	DroppedRelationships []string
+	// BlockingRelationships lists relationship types which stop a node being concorded. The three lists ignore the
+	// types the writer owns, such as REDIRECTS_TO, which are always moved
+	BlockingRelationships []string
+	// RepointedLoopRelationships lists relationship types which, between a node being concorded and the canonical
+	// organisation, are kept as a relationship of the organisation with itself. Those of other types are dropped
+	RepointedLoopRelationships []string
+	// FoldSourceNames keeps the names of organisations concorded away as former names and aliases of the canonical one
+	FoldSourceNames bool
+	// WriteRetries is how many times a write failing with a transient Neo4j error, such as a deadlock, is retried
+	WriteRetries int
+	// WriteRetryBackoff is the wait before the first retry of a write, which doubles with every further retry
+	WriteRetryBackoff time.Duration
+	// OrgTypes are the supported organisation types and their labels. When empty, only the default types are supported
+	OrgTypes OrgTypes
+	// LockRunner runs the claims and releases of the write locks shared with other instances, each in a transaction of
+	// its own. It must not batch them with the queries of other requests. When nil, the connection runs them
+	LockRunner neoutils.CypherRunner
 }
 
 //NewCypherOrganisationService returns a new service responsible for writing organisations in Neo4j
-func NewCypherOrganisationService(cypherRunner neoutils.NeoConnection) service {
-	return service{cypherRunner}
+func NewCypherOrganisationService(cypherRunner neoutils.NeoConnection, config Config) service {
+	return service{cypherRunner, config}
 }
 
 func (cd service) Initialise() error {
 
 	err := cd.conn.EnsureIndexes(map[string]string{
-		"Identifier": "value",
+		"Identifier":       "value",
+		"ConcordanceAudit": "canonicalUUID",
+		"WriteLock":        "owner",
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// audits are looked up by either uuid, and the map only takes one property per label
+	err = cd.conn.EnsureIndexes(map[string]string{
+		"ConcordanceAudit": "sourceUUID",
 	})
 
 	if err != nil {
@@ -34,7 +76,13 @@ func (cd service) Initialise() error {
 		"Organisation":      "uuid",
 		"FactsetIdentifier": "value",
 		"TMEIdentifier":     "value",
-		"UPPIdentifier":     "value"})
+		"UPPIdentifier":     "value",
+		"ISINIdentifier":    "value",
+		"SEDOLIdentifier":   "value",
+		"CUSIPIdentifier":   "value",
+		"TickerIdentifier":  "value",
+		"Redirect":          "uuid",
+		"WriteLock":         "uuid"})
 }
 
 func setProps(props *map[string]interface{}, item *string, propName string) {
@@ -57,19 +105,144 @@ func setListProps(props *map[string]interface{}, itemList *[]string, propName st
 
 //Write - Writes an Organisation node
 func (cd service) Write(thing interface{}, transId string) error {
+	_, err := cd.WriteOrganisation(thing.(organisation), writeOptions{}, transId)
+	return err
+}
+
+//WriteOrganisation - Writes an Organisation node, unless the stored one was written from an identical payload
+//and there are no old nodes left to concord. Force rewrites it regardless.
+//The write is refused with a concurrentWriteError while another one has any of its uuids.
+//When an expected revision is given, the write is rejected unless it is the one stored. The revision is read while the
+//uuids are locked, so no other write can change it before this one runs.
+//When any revision is expected, the write is rejected unless the organisation exists.
+//A dry run plans the write in full but returns the queries and a summary of their effects instead of running them
+func (cd service) WriteOrganisation(o organisation, opts writeOptions, transId string) (writeResult, error) {
+	var state writeState
+	var err error
+	if opts.DryRun {
+		state, err = cd.readWriteState(o)
+	} else {
+		var lock *writeLock
+		state, lock, err = cd.lockWrite(o, opts)
+		if err == nil {
+			defer cd.unlock(lock)
+		}
+	}
+	if err != nil {
+		return writeResult{}, err
+	}
+
+	plan, err := cd.planWrite(o, opts, state, transId)
+	if err != nil {
+		return writeResult{}, err
+	}
+
+	if opts.DryRun {
+		return cd.describePlan(o, plan, transId)
+	}
+
+	if len(plan.Queries) == 0 {
+		return plan.Result, nil
+	}
+
+	if err := cd.writeBatch(plan.Queries); err != nil {
+		return writeResult{}, err
+	}
+	return plan.Result, nil
+}
+
+// writePlan holds the queries writing an organisation, the old nodes they merge, and the result of running them.
+// There are no queries when the write is skipped
+type writePlan struct {
+	Queries []*neoism.CypherQuery
+	Merges  []plannedMerge
+	Result  writeResult
+}
+
+// planWrite plans the write of the organisation over its stored state
+func (cd service) planWrite(o organisation, opts writeOptions, state writeState, transId string) (writePlan, error) {
+	hash, err := hashOrganisation(o)
+	if err != nil {
+		return writePlan{}, err
+	}
+
+	if err := cd.checkParentCycle(o); err != nil {
+		return writePlan{}, err
+	}
+
+	if opts.IfMatchAny && !state.Exists {
+		return writePlan{}, preconditionFailedError{fmt.Sprintf("Organisation %s does not exist", o.UUID)}
+	}
+
+	if opts.IfMatchRevision != nil && (!state.Exists || state.Revision != *opts.IfMatchRevision) {
+		return writePlan{}, preconditionFailedError{fmt.Sprintf("Organisation %s is at revision %d, not %d", o.UUID, state.Revision, *opts.IfMatchRevision)}
+	}
+
+	if !opts.Force && state.Exists && state.Hash == hash && state.OldNodes == 0 {
+		return writePlan{Result: writeResult{Changed: false, Revision: state.Revision}}, nil
+	}
+
+	queries, merges, err := cd.constructWriteOrganisationQueries(o, hash, transId)
+	if err != nil {
+		return writePlan{}, err
+	}
+
+	return writePlan{Queries: queries, Merges: merges, Result: writeResult{Changed: true, Revision: state.Revision + 1}}, nil
+}
+
+//Patch - Applies a merge patch to the stored organisation and writes the result. Unless an expected revision is given,
+//the write is rejected if the organisation changed since it was read for patching
+func (cd service) Patch(uuid string, patch map[string]interface{}, opts writeOptions, transId string) (writeResult, bool, error) {
+	o, revision, found, err := cd.ReadWithRevision(uuid, transId)
+	if err != nil || !found {
+		return writeResult{}, found, err
+	}
+
+	patched, err := applyPatch(o, patch)
+	if err != nil {
+		return writeResult{}, true, err
+	}
+
+	if err := validateOrganisation(patched, cd.config.orgTypes()); err != nil {
+		return writeResult{}, true, err
+	}
+
+	if opts.IfMatchRevision == nil {
+		opts.IfMatchRevision = &revision
+	}
+
+	result, err := cd.WriteOrganisation(patched, opts, transId)
+	return result, true, err
+}
+
+// constructWriteOrganisationQueries builds the queries writing the organisation, along with the old nodes they concord into it
+func (cd service) constructWriteOrganisationQueries(o organisation, hash string, transId string) ([]*neoism.CypherQuery, []plannedMerge, error) {
+	// the merges are planned first, as the names of the nodes they concord may be kept on the organisation
+	mergingQueriesForOldNodes, merges, err := cd.constructMergingOldOrganisationNodesQueries(o.UUID, o.AlternativeIdentifiers.UUIDS, transId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cd.config.FoldSourceNames {
+		o, merges, err = cd.foldConcordedNames(o, merges)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-	o := thing.(organisation)
 	props := constructOrganisationProperties(o)
+	props["hash"] = hash
 
+	types := cd.config.orgTypes()
 	deleteEntityRelationshipsQuery := constructDeleteEntityRelationshipQuery(o.UUID)
-	resetOrgQuery := constructResetOrganisationQuery(o.UUID, props)
+	resetOrgQuery := constructResetOrganisationQuery(o.UUID, props, types.removableLabels())
 
-	queries := []*neoism.CypherQuery{deleteEntityRelationshipsQuery, resetOrgQuery}
+	queries := []*neoism.CypherQuery{deleteEntityRelationshipsQuery, resetOrgQuery, constructDeleteRedirectQuery(o.UUID)}
 
 	//add type
-	err, stringType := o.Type.String()
+	labels, err := types.labels(o.Type)
 	if err == nil {
-		setTypeStatement := fmt.Sprintf(`MERGE (o:Thing {uuid: {uuid}})  set o : %s `, stringType)
+		setTypeStatement := fmt.Sprintf(`MERGE (o:Thing {uuid: {uuid}})  set o : %s `, strings.Join(labels, ":"))
 		setTypeQuery := &neoism.CypherQuery{
 			Statement: setTypeStatement,
 			Parameters: map[string]interface{}{
@@ -79,12 +252,7 @@ func (cd service) Write(thing interface{}, transId string) error {
 		queries = append(queries, setTypeQuery)
 
 	} else {
-		return err
-	}
-
-	mergingQueriesForOldNodes, err := cd.constructMergingOldOrganisationNodesQueries(o.UUID, o.AlternativeIdentifiers.UUIDS)
-	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if len(mergingQueriesForOldNodes) != 0 {
@@ -110,6 +278,12 @@ func (cd service) Write(thing interface{}, transId string) error {
 		queries = append(queries, createNewIdentifierQuery(o.UUID, leiIdentifierLabel, o.AlternativeIdentifiers.LeiCode))
 	}
 
+	for _, market := range marketIdentifiers {
+		for _, value := range *market.list(&o.AlternativeIdentifiers) {
+			queries = append(queries, createNewIdentifierQuery(o.UUID, market.label, value))
+		}
+	}
+
 	if o.IndustryClassification != "" {
 		industryClassQuery := constructCreateIndustryClassificationQuery(o.UUID, o.IndustryClassification)
 		queries = append(queries, industryClassQuery)
@@ -119,123 +293,146 @@ func (cd service) Write(thing interface{}, transId string) error {
 		parentQuery := constructCreateParentOrganisationQuery(o.UUID, o.ParentOrganisation)
 		queries = append(queries, parentQuery)
 	}
-	return cd.conn.CypherBatch(queries)
+	return queries, merges, nil
 }
 
-func (cd service) constructMergingOldOrganisationNodesQueries(canonicalUUID string, possibleOldNodes []string) ([]*neoism.CypherQuery, error) {
+type writeState struct {
+	Exists   bool   `json:"found"`
+	Hash     string `json:"hash"`
+	Revision int    `json:"revision"`
+	Parent   string `json:"parent"`
+	OldNodes int    `json:"oldNodes"`
+}
 
-	queries := []*neoism.CypherQuery{}
+// readWriteState reads the stored hash, revision and parent of the organisation, and how many of its alternative uuids
+// are separate nodes
+func (cd service) readWriteState(o organisation) (writeState, error) {
+	results := []writeState{}
 
-	for _, identifier := range possibleOldNodes {
-		// only nodes with uppAuthority can be older organisation nodes
-		if identifier != canonicalUUID {
-			nodeExists, err := cd.checkNodeExistence(identifier)
-			if err != nil {
-				return nil, err
-			}
-			if nodeExists {
-				deleteEntityRelationshipsForDeprecatedOrgNodeQuery := constructDeleteEntityRelationshipQuery(identifier)
-				queries = append(queries, deleteEntityRelationshipsForDeprecatedOrgNodeQuery)
-
-				// re-point the remaining relationships from previous node to the canonical/actual one
-				transferQueries, err := CreateTransferRelationshipsQueries(cd.conn, canonicalUUID, identifier)
-				if err != nil {
-					return nil, err
-				}
-				if len(transferQueries) != 0 {
-					queries = append(queries, transferQueries...)
-				}
-
-				// delete oldOrg
-				deleteOldOrganisationQuery := constructDeleteEmptyNodeQuery(identifier)
-				queries = append(queries, deleteOldOrganisationQuery)
-			}
+	oldUUIDs := []string{}
+	for _, uuid := range o.AlternativeIdentifiers.UUIDS {
+		if uuid != o.UUID {
+			oldUUIDs = append(oldUUIDs, uuid)
 		}
 	}
 
-	return queries, nil
-}
+	readQuery := &neoism.CypherQuery{
+		Statement: `OPTIONAL MATCH (o:Organisation {uuid:{uuid}})
+				OPTIONAL MATCH (o)-[:SUB_ORGANISATION_OF]->(p:Thing)
+				WITH o, head(collect(p.uuid)) as parent
+				OPTIONAL MATCH (old:Thing) WHERE old.uuid IN {oldUUIDs}
+				RETURN o IS NOT NULL as found, o.hash as hash, coalesce(o.revision, 0) as revision, parent,
+					count(old) as oldNodes`,
+		Parameters: map[string]interface{}{
+			"uuid":     o.UUID,
+			"oldUUIDs": oldUUIDs,
+		},
+		Result: &results,
+	}
 
-func (cd service) checkNodeExistence(uuid string) (bool, error) {
-	type result []struct {
-		Count int `json:"nr"`
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{readQuery}); err != nil {
+		return writeState{}, err
 	}
-	res := result{}
 
-	checkNodeExistenceQuery := &neoism.CypherQuery{
-		Statement: `match (a:Thing{uuid:{uuid}})
-			           return count(a) as nr`,
-		Parameters: map[string]interface{}{
-			"uuid": uuid,
-		},
-		Result: &res,
+	if len(results) != 1 {
+		return writeState{}, fmt.Errorf("DB inconsistence: one state result should be returned for node with UUID %s", o.UUID)
 	}
 
-	readQueries := []*neoism.CypherQuery{checkNodeExistenceQuery}
-	err := cd.conn.CypherBatch(readQueries)
+	return results[0], nil
+}
 
+func (cd service) constructMergingOldOrganisationNodesQueries(canonicalUUID string, possibleOldNodes []string, transId string) ([]*neoism.CypherQuery, []plannedMerge, error) {
+
+	queries := []*neoism.CypherQuery{}
+	merges := []plannedMerge{}
+
+	candidates, err := cd.readConcordanceCandidates(canonicalUUID, possibleOldNodes)
 	if err != nil {
-		return false, err
+		return nil, nil, err
 	}
 
-	if len(res) != 1 {
-		return false, fmt.Errorf("DB inconsistence: one count result should be returned for node with UUID %s", uuid)
-	}
+	for _, identifier := range candidates.uuids {
+		// only nodes with uppAuthority can be older organisation nodes
+		nodeExists, err := candidates.exists(identifier)
+		if err != nil {
+			return nil, nil, err
+		}
+		if nodeExists {
+			deleteEntityRelationshipsForDeprecatedOrgNodeQuery := constructDeleteEntityRelationshipQuery(identifier)
+			queries = append(queries, deleteEntityRelationshipsForDeprecatedOrgNodeQuery)
+
+			// re-point the remaining relationships from previous node to the canonical/actual one
+			relationshipsFromOldNode, relationshipsToOldNode := candidates.relationships.Relationships(identifier)
+			edges := candidates.relationships.Edges(identifier)
+			moved, dropped, blocking := cd.config.concordedRelationships(relationshipsFromOldNode, relationshipsToOldNode, edges.Loops)
+			if len(blocking) > 0 {
+				return nil, nil, blockedConcordanceError(canonicalUUID, identifier, blocking)
+			}
+			transferQueries, stats := cd.config.constructTransferRelationshipsQueries(canonicalUUID, identifier, relationshipsFromOldNode, relationshipsToOldNode, edges)
+			if len(transferQueries) != 0 {
+				queries = append(queries, transferQueries...)
+			}
+			queries = append(queries, constructDropRelationshipsQueries(identifier, dropped)...)
+
+			merge := plannedMerge{
+				SourceUUID:    identifier,
+				Source:        candidates.organisation(identifier),
+				Relationships: moved,
+				Dropped:       dropped,
+				Loops:         concordedLoops(stats.Loops),
+				Collapsed:     stats.Collapsed,
+			}
+			merges = append(merges, merge)
 
-	if res[0].Count == 0 {
-		return false, nil
-	} else if res[0].Count == 1 {
-		return true, nil
-	} else {
-		return false, fmt.Errorf("DB inconsistence: %d node (instead of max 1) exists with UUID %s", res[0].Count, uuid)
+			auditQuery, err := constructConcordanceAuditQuery(canonicalUUID, transId, merge)
+			if err != nil {
+				return nil, nil, err
+			}
+			queries = append(queries, auditQuery)
+
+			queries = append(queries, constructCreateRedirectQuery(identifier, canonicalUUID))
+
+			// delete oldOrg
+			deleteOldOrganisationQuery := constructDeleteEmptyNodeQuery(identifier)
+			queries = append(queries, deleteOldOrganisationQuery)
+		}
 	}
+
+	return queries, merges, nil
 }
 
 //Read - Internal Read of an Organisation
 func (cd service) Read(uuid string, transId string) (interface{}, bool, error) {
+	o, _, found, err := cd.ReadWithRevision(uuid, transId)
+	return o, found, err
+}
+
+//ReadWithRevision - Reads an Organisation along with the revision it was last written at
+func (cd service) ReadWithRevision(uuid string, transId string) (organisation, int, bool, error) {
+
+	results := []organisationResult{}
+
+	readQuery := constructReadOrganisationsQuery(`MATCH (o:Organisation:Concept{uuid:{uuid}})`,
+		map[string]interface{}{
+			"uuid": uuid,
+		}, &results)
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{readQuery}); err != nil || len(results) == 0 {
+		return organisation{}, 0, false, err
+	}
+
+	return results[0].toOrganisation(cd.config.orgTypes()), results[0].Revision, true, nil
+}
 
+//ReadRedirect - Returns the uuid of the canonical organisation which a uuid was concorded into
+func (cd service) ReadRedirect(uuid string, transId string) (string, bool, error) {
 	results := []struct {
-		UUID                   string                 `json:"uuid"`
-		Type                   []string               `json:"type"`
-		ProperName             string                 `json:"properName"`
-		PrefLabel              string                 `json:"prefLabel"`
-		LegalName              string                 `json:"legalName"`
-		ShortName              string                 `json:"shortName"`
-		HiddenLabel            string                 `json:"hiddenLabel"`
-		AlternativeIdentifiers alternativeIdentifiers `json:"alternativeIdentifiers"`
-		TradeNames             []string               `json:"tradeNames"`
-		LocalNames             []string               `json:"localNames"`
-		FormerNames            []string               `json:"formerNames"`
-		Aliases                []string               `json:"aliases"`
-		IndustryClassification string                 `json:"industryClassification"`
-		ParentOrganisation     string                 `json:"parentOrganisation"`
+		UUID string `json:"uuid"`
 	}{}
 
 	readQuery := &neoism.CypherQuery{
-		Statement: `MATCH (o:Organisation:Concept{uuid:{uuid}})
-            			OPTIONAL MATCH (o)-[:SUB_ORGANISATION_OF]->(par:Thing)
-            			OPTIONAL MATCH (o)-[:HAS_CLASSIFICATION]->(ind:Thing)
-           			OPTIONAL MATCH (upp:UPPIdentifier)-[:IDENTIFIES]->(o)
-	    			OPTIONAL MATCH (factset:FactsetIdentifier)-[:IDENTIFIES]->(o)
-	   			OPTIONAL MATCH (tme:TMEIdentifier)-[:IDENTIFIES]->(o)
-	    			OPTIONAL MATCH (lei:LegalEntityIdentifier)-[:IDENTIFIES]->(o)
-            		 	RETURN o.uuid as uuid,
-					o.properName as properName,
-					labels(o) as Type,
-					o.prefLabel as prefLabel,
-					o.legalName as legalName,
-					o.shortName as shortName,
-					o.hiddenLabel as hiddenLabel,
-					o.formerNames as formerNames,
-					o.tradeNames as tradeNames,
-					o.localNames as localNames,
-					o.aliases as aliases,
-					ind.uuid as industryClassification,
-					par.uuid as parentOrganisation,
-					{uuids:collect(distinct upp.value),
-					 TME:collect(distinct tme.value),
-					 factsetIdentifier:factset.value,
-					 leiCode:lei.value} as alternativeIdentifiers`,
+		Statement: `MATCH (:Redirect {uuid:{uuid}})-[:REDIRECTS_TO]->(o:Organisation:Concept)
+					RETURN o.uuid as uuid`,
 		Parameters: map[string]interface{}{
 			"uuid": uuid,
 		},
@@ -243,11 +440,106 @@ func (cd service) Read(uuid string, transId string) (interface{}, bool, error) {
 	}
 
 	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{readQuery}); err != nil || len(results) == 0 {
-		return organisation{}, false, err
+		return "", false, err
+	}
+
+	return results[0].UUID, true, nil
+}
+
+//ReadByIdentifier - Reads the canonical organisations identified by an alternative identifier
+func (cd service) ReadByIdentifier(identifierType string, value string, transId string) ([]organisation, error) {
+	identifierLabel, ok := identifierLabels[identifierType]
+	if !ok {
+		return nil, requestError{fmt.Sprintf("Unsupported identifier type '%s'", identifierType)}
+	}
+
+	results := []organisationResult{}
+
+	readQuery := constructReadOrganisationsQuery(fmt.Sprintf(`MATCH (i:Identifier:%s {value:{value}})-[:IDENTIFIES]->(o:Organisation:Concept)
+					WITH DISTINCT o`, identifierLabel),
+		map[string]interface{}{
+			"value": value,
+		}, &results)
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{readQuery}); err != nil {
+		return nil, err
+	}
+
+	orgs := []organisation{}
+	for _, result := range results {
+		orgs = append(orgs, result.toOrganisation(cd.config.orgTypes()))
+	}
+
+	return orgs, nil
+}
+
+//List - Lists a page of organisations matching the filter in uuid order, starting after the cursor uuid.
+//The returned cursor is empty when there are no further pages
+func (cd service) List(filter listFilter, cursor string, limit int, transId string) ([]organisation, string, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, "", requestError{err.Error()}
+	}
+	subtypes := []string{}
+	if filter.Type != "" {
+		if _, err := cd.config.orgTypes().labels(filter.Type); err != nil {
+			return nil, "", requestError{err.Error()}
+		}
+		if !filter.IncludeSubtypes {
+			subtypes = cd.config.orgTypes().subtypes(filter.Type)
+		}
+	}
+
+	results := []organisationResult{}
+
+	// read one more than asked for so we know whether there is a next page
+	listQuery := constructReadOrganisationsQuery(constructListOrganisationsMatchClause(filter, subtypes),
+		map[string]interface{}{
+			"cursor": cursor,
+			"prefix": filter.PrefLabelPrefix,
+			"limit":  limit + 1,
+		}, &results)
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{listQuery}); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(results) > limit {
+		results = results[:limit]
+		next = results[limit-1].UUID
+	}
+
+	orgs := []organisation{}
+	for _, result := range results {
+		orgs = append(orgs, result.toOrganisation(cd.config.orgTypes()))
 	}
 
-	result := results[0]
+	return orgs, next, nil
+}
+
+type organisationResult struct {
+	UUID                   string                 `json:"uuid"`
+	Type                   []string               `json:"type"`
+	ProperName             string                 `json:"properName"`
+	PrefLabel              string                 `json:"prefLabel"`
+	LegalName              string                 `json:"legalName"`
+	ShortName              string                 `json:"shortName"`
+	HiddenLabel            string                 `json:"hiddenLabel"`
+	AlternativeIdentifiers alternativeIdentifiers `json:"alternativeIdentifiers"`
+	TradeNames             []string               `json:"tradeNames"`
+	LocalNames             []string               `json:"localNames"`
+	FormerNames            []string               `json:"formerNames"`
+	Aliases                []string               `json:"aliases"`
+	IndustryClassification string                 `json:"industryClassification"`
+	ParentOrganisation     string                 `json:"parentOrganisation"`
+	Revision               int                    `json:"revision"`
+	MarketIdentifiers      []struct {
+		Labels []string `json:"labels"`
+		Value  string   `json:"value"`
+	} `json:"marketIdentifiers"`
+}
 
+func (result organisationResult) toOrganisation(types OrgTypes) organisation {
 	o := organisation{
 		UUID:                   result.UUID,
 		ProperName:             result.ProperName,
@@ -264,37 +556,37 @@ func (cd service) Read(uuid string, transId string) (interface{}, bool, error) {
 		IndustryClassification: result.IndustryClassification,
 	}
 
-	addType(&o.Type, &result.Type)
+	o.Type, o.UnknownLabels = types.readType(result.Type)
 	sort.Strings(o.AlternativeIdentifiers.TME)
 	sort.Strings(o.AlternativeIdentifiers.UUIDS)
 
-	return o, true, nil
-}
-
-func addType(orgType *OrgType, types *[]string) {
-	i := len(*types)
-	if i == 3 {
-		*orgType = Organisation
-	}
-	if i == 4 {
-		*orgType = Company
-	}
-	if i == 5 {
-		*orgType = PublicCompany
+	// the list of an organisation without any of these identifiers is left out
+	for _, market := range marketIdentifiers {
+		list := market.list(&o.AlternativeIdentifiers)
+		*list = nil
+		for _, id := range result.MarketIdentifiers {
+			if containsString(id.Labels, market.label) {
+				*list = append(*list, id.Value)
+			}
+		}
+		sort.Strings(*list)
 	}
+
+	return o
 }
 
 //Delete - Deletes an Organisation
 func (cd service) Delete(uuid string, transId string) (bool, error) {
 	clearNode := &neoism.CypherQuery{
-		Statement: `
+		Statement: fmt.Sprintf(`
 			MATCH (org:Thing {uuid: {uuid}})
 			OPTIONAL MATCH (org)-[so:SUB_ORGANISATION_OF]->(par:Thing)
 			OPTIONAL MATCH (org)-[cb:HAS_CLASSIFICATION]->(ic:Thing)
-			REMOVE org:Concept:Organisation:Company:PublicCompany
-			DELETE so, cb
+			OPTIONAL MATCH (org)<-[rt:REDIRECTS_TO]-(r:Redirect)
+			REMOVE org:%s
+			DELETE so, cb, rt, r
 			SET org={uuid: {uuid}}
-		`,
+		`, strings.Join(cd.config.orgTypes().removableLabels(), ":")),
 		Parameters: map[string]interface{}{
 			"uuid": uuid,
 		},
@@ -317,7 +609,9 @@ func (cd service) Delete(uuid string, transId string) (bool, error) {
 		},
 	}
 
-	err := cd.conn.CypherBatch(removeNodeIfUnused)
+	if err := cd.writeBatch(removeNodeIfUnused); err != nil {
+		return false, err
+	}
 
 	s1, err := clearNode.Stats()
 
@@ -356,10 +650,49 @@ func (cd service) Count() (int, error) {
 	return results[0].Count, nil
 }
 
+const idsBatchSize = 1000
+
+//IDs - Streams the uuid and content hash of every organisation in uuid order, reading them from Neo4j in batches
+func (cd service) IDs(f func(rwapi.IDEntry) (bool, error)) error {
+	cursor := ""
+	for {
+		results := []rwapi.IDEntry{}
+		idsQuery := &neoism.CypherQuery{
+			Statement: `MATCH (o:Organisation) WHERE o.uuid > {cursor}
+					RETURN o.uuid as id, o.hash as hash
+					ORDER BY o.uuid LIMIT {limit}`,
+			Parameters: map[string]interface{}{
+				"cursor": cursor,
+				"limit":  idsBatchSize,
+			},
+			Result: &results,
+		}
+
+		if err := cd.conn.CypherBatch([]*neoism.CypherQuery{idsQuery}); err != nil {
+			return err
+		}
+
+		for _, entry := range results {
+			more, err := f(entry)
+			if err != nil || !more {
+				return err
+			}
+		}
+
+		if len(results) < idsBatchSize {
+			return nil
+		}
+		cursor = results[len(results)-1].ID
+	}
+}
+
+//DecodeJSON - Decodes and validates an organisation, returning a requestError listing every invalid field
 func (cd service) DecodeJSON(dec *json.Decoder) (interface{}, string, error) {
 	org := organisation{}
-	err := dec.Decode(&org)
-	return org, org.UUID, err
+	if err := dec.Decode(&org); err != nil {
+		return org, org.UUID, err
+	}
+	return org, org.UUID, validateOrganisation(org, cd.config.orgTypes())
 }
 
 type requestError struct {
@@ -373,3 +706,28 @@ func (re requestError) Error() string {
 func (re requestError) InvalidRequestDetails() string {
 	return re.details
 }
+
+type preconditionFailedError struct {
+	details string
+}
+
+func (pe preconditionFailedError) Error() string {
+	return "Precondition Failed"
+}
+
+func (pe preconditionFailedError) PreconditionFailedDetails() string {
+	return pe.details
+}
+
+// concurrentWriteError is returned when another write holds one of the uuids of an organisation. It can be retried
+type concurrentWriteError struct {
+	details string
+}
+
+func (ce concurrentWriteError) Error() string {
+	return "Concurrent Write"
+}
+
+func (ce concurrentWriteError) ConcurrentWriteDetails() string {
+	return ce.details
+}
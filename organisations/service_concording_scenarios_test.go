@@ -3,8 +3,10 @@ package organisations
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/annotations-rw-neo4j/annotations"
 	"github.com/Financial-Times/neo-utils-go/neoutils"
@@ -129,6 +131,52 @@ func TestConcordeThreeOrganisations(t *testing.T) {
 	assert.Equal(org1Updated, org1Stored)
 }
 
+func TestReadByConcordedUPPIdentifierResolvesToCanonicalOrganisation(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	org1Updated := org1
+	org1Updated.AlternativeIdentifiers.UUIDS = []string{org1UUID, org2UUID}
+
+	assert.NoError(cypherDriver.Write(org1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org1Updated, "TEST_TRANS_ID"))
+
+	orgs, err := cypherDriver.ReadByIdentifier("upp", org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Len(orgs, 1)
+	assert.Equal(org1UUID, orgs[0].UUID)
+}
+
+func TestUnchangedWriteStillConcordesRecreatedOldNode(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	org1Updated := org1
+	org1Updated.AlternativeIdentifiers.UUIDS = []string{org1UUID, org2UUID}
+
+	assert.NoError(cypherDriver.Write(org1Updated, "TEST_TRANS_ID"))
+
+	// the old node is written again after the canonical one, e.g. by an out of date publish
+	org2WithoutUPPClash := org2
+	org2WithoutUPPClash.AlternativeIdentifiers.UUIDS = []string{}
+	org2WithoutUPPClash.ParentOrganisation = ""
+	assert.NoError(cypherDriver.Write(org2WithoutUPPClash, "TEST_TRANS_ID"))
+
+	result, err := cypherDriver.WriteOrganisation(org1Updated, writeOptions{}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(result.Changed, "Write should not be skipped while an old node is left to concorde")
+
+	_, found, _ := cypherDriver.Read(org2UUID, "TEST_TRANS_ID")
+	assert.False(found, "Organisation for uuid %s should have been deleted", org2UUID)
+}
+
 // concorde node with multiple major mentions (mentions with platformVersion v1)
 func TestConcordeOrganisationsWithRelationships(t *testing.T) {
 	assert := assert.New(t)
@@ -301,6 +349,332 @@ func TestTransferIncomingHasSubOrganisationOfRelationships(t *testing.T) {
 
 }
 
+func TestConcordingRecordsAnAudit(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	assert.NoError(cypherDriver.Write(org1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org3, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org8, "TEST_TRANS_ID"))
+
+	audits, err := cypherDriver.ConcordanceAudits(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Empty(audits)
+
+	updatedOrg1 := organisation{
+		UUID: org1UUID,
+		Type: Organisation,
+		AlternativeIdentifiers: alternativeIdentifiers{
+			FactsetIdentifier: fsOrg1Identifier,
+			UUIDS:             []string{org1UUID, org2UUID},
+			TME:               []string{tmeOrg2Identifier},
+		},
+		ProperName:         "Updated Name",
+		ParentOrganisation: org8UUID,
+	}
+	before := time.Now().Add(-time.Minute)
+	assert.NoError(cypherDriver.Write(updatedOrg1, "CONCORDING_TRANS_ID"))
+
+	for _, uuid := range []string{org1UUID, org2UUID} {
+		audits, err := cypherDriver.ConcordanceAudits(uuid, "TEST_TRANS_ID")
+		assert.NoError(err)
+		if !assert.Len(audits, 1, "audits for %s", uuid) {
+			continue
+		}
+		assert.Equal(org1UUID, audits[0].CanonicalUUID)
+		assert.Equal(org2UUID, audits[0].SourceUUID)
+		assert.Equal("CONCORDING_TRANS_ID", audits[0].TransactionID)
+		assert.True(audits[0].Timestamp.After(before))
+		// org2's own SUB_ORGANISATION_OF and identifiers are deleted rather than moved
+		assert.Equal([]movedRelationships{{Type: "SUB_ORGANISATION_OF", Direction: incomingDirection, Count: 1}}, audits[0].Relationships)
+	}
+
+	audits, err = cypherDriver.ConcordanceAudits(org3UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Empty(audits)
+}
+
+func TestConcordedUUIDRedirectsToCanonicalOrganisation(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org8, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org9, "TEST_TRANS_ID"))
+
+	// org2 is concorded into org9, which is concorded into org1 in turn
+	org9Updated := org9
+	org9Updated.AlternativeIdentifiers.UUIDS = []string{org9UUID, org2UUID}
+	assert.NoError(cypherDriver.Write(org9Updated, "TEST_TRANS_ID"))
+
+	canonicalUUID, redirected, err := cypherDriver.ReadRedirect(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(redirected)
+	assert.Equal(org9UUID, canonicalUUID)
+
+	org1Updated := org1
+	org1Updated.AlternativeIdentifiers.UUIDS = []string{org1UUID, org2UUID, org9UUID}
+	assert.NoError(cypherDriver.Write(org1Updated, "TEST_TRANS_ID"))
+
+	for _, uuid := range []string{org2UUID, org9UUID} {
+		canonicalUUID, redirected, err := cypherDriver.ReadRedirect(uuid, "TEST_TRANS_ID")
+		assert.NoError(err)
+		assert.True(redirected, "%s should redirect", uuid)
+		assert.Equal(org1UUID, canonicalUUID)
+	}
+
+	rec := serveRequestWithBody(cypherDriver, "GET", "/organisations/"+org2UUID, "")
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+	assert.Equal("/organisations/"+org1UUID, rec.Header().Get("Location"))
+
+	rec = serveRequestWithBody(cypherDriver, "GET", "/organisations/"+org2UUID+"?followRedirect=true", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("/organisations/"+org1UUID, rec.Header().Get("Content-Location"))
+	followed := organisation{}
+	assert.NoError(json.NewDecoder(rec.Body).Decode(&followed))
+	assert.Equal(org1UUID, followed.UUID)
+
+	// a uuid written as an organisation again is not redirected any more
+	assert.NoError(cypherDriver.Write(org9, "TEST_TRANS_ID"))
+	_, redirected, err = cypherDriver.ReadRedirect(org9UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(redirected)
+
+	// nor are the uuids concorded into a deleted organisation
+	deleted, err := cypherDriver.Delete(org1UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(deleted)
+	rec = serveRequestWithBody(cypherDriver, "GET", "/organisations/"+org2UUID, "")
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestUnmergeRestoresConcordedOrganisation(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	assert.NoError(cypherDriver.Write(org1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org3, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org8, "TEST_TRANS_ID"))
+
+	_, found, err := cypherDriver.Unmerge(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(found, "org2 has not been concorded yet")
+
+	updatedOrg1 := organisation{
+		UUID: org1UUID,
+		Type: Organisation,
+		AlternativeIdentifiers: alternativeIdentifiers{
+			FactsetIdentifier: fsOrg1Identifier,
+			UUIDS:             []string{org1UUID, org2UUID},
+			TME:               []string{tmeOrg2Identifier},
+		},
+		ProperName:         "Updated Name",
+		ParentOrganisation: org8UUID,
+	}
+	assert.NoError(cypherDriver.Write(updatedOrg1, "TEST_TRANS_ID"))
+
+	result, found, err := cypherDriver.Unmerge(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(unmergeResult{
+		CanonicalUUID:       org1UUID,
+		SourceUUID:          org2UUID,
+		Relationships:       []movedRelationships{{Type: "SUB_ORGANISATION_OF", Direction: incomingDirection, Count: 1}},
+		RetainedIdentifiers: []identifierValue{{Label: tmeIdentifierLabel, Value: tmeOrg2Identifier}},
+	}, result)
+
+	// org2 is back, without the TME identifier org1 still holds
+	restoredOrg2 := org2
+	restoredOrg2.AlternativeIdentifiers.TME = []string{}
+	storedOrg2, found, err := cypherDriver.Read(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(restoredOrg2, storedOrg2)
+
+	storedOrg1, _, err := cypherDriver.Read(org1UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal([]string{org1UUID}, storedOrg1.(organisation).AlternativeIdentifiers.UUIDS)
+
+	storedOrg3, _, err := cypherDriver.Read(org3UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal(org2UUID, storedOrg3.(organisation).ParentOrganisation)
+
+	_, redirected, err := cypherDriver.ReadRedirect(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(redirected)
+}
+
+func TestDryRunDescribesConcordingWithoutWriting(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	assert.NoError(cypherDriver.Write(org1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org3, "TEST_TRANS_ID"))
+
+	updatedOrg1 := org1
+	updatedOrg1.AlternativeIdentifiers = alternativeIdentifiers{
+		FactsetIdentifier: fsOrg1Identifier,
+		UUIDS:             []string{org1UUID, org2UUID},
+		TME:               []string{},
+	}
+
+	result, err := cypherDriver.WriteOrganisation(updatedOrg1, writeOptions{DryRun: true}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(result.Changed)
+	if assert.NotNil(result.DryRun) {
+		assert.NotEmpty(result.DryRun.Queries)
+		assert.Equal([]string{
+			fmt.Sprintf("Organisation %s would be updated from revision 1 to 2", org1UUID),
+			fmt.Sprintf("Node %s would be merged into %s, moving 1 incoming SUB_ORGANISATION_OF, and left as a redirect", org2UUID, org1UUID),
+			fmt.Sprintf("TMEIdentifier '%s' of merged organisation %s would be removed", tmeOrg2Identifier, org2UUID),
+			fmt.Sprintf("LegalEntityIdentifier '%s' would be removed", leiCodeOrgxIdentifier),
+			fmt.Sprintf("UPPIdentifier '%s' would be added", org2UUID),
+		}, result.DryRun.Summary)
+	}
+
+	storedOrg2, found, err := cypherDriver.Read(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found, "the dry run should not have concorded org2")
+	assert.Equal(org2, storedOrg2)
+
+	storedOrg1, _, err := cypherDriver.Read(org1UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal(org1, storedOrg1)
+}
+
+func TestConcordingFoldsSourceNamesWhenConfigured(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := NewCypherOrganisationService(db, Config{BatchSize: 1024, FoldSourceNames: true})
+	cypherDriver.Initialise()
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	namedOrg2 := org2
+	namedOrg2.PrefLabel = "Org 2"
+	namedOrg2.Aliases = []string{"Org Two", "Proper Name 1"}
+
+	assert.NoError(cypherDriver.Write(org1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(namedOrg2, "TEST_TRANS_ID"))
+
+	updatedOrg1 := org1
+	updatedOrg1.AlternativeIdentifiers = alternativeIdentifiers{
+		FactsetIdentifier: fsOrg1Identifier,
+		UUIDS:             []string{org1UUID, org2UUID},
+		TME:               []string{},
+	}
+
+	result, err := cypherDriver.WriteOrganisation(updatedOrg1, writeOptions{DryRun: true}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	if assert.NotNil(result.DryRun) {
+		assert.Contains(result.DryRun.Summary, fmt.Sprintf("Names of merged organisation %s would be kept as former names: Org 2, Proper Name 2", org2UUID))
+		assert.Contains(result.DryRun.Summary, fmt.Sprintf("Aliases of merged organisation %s would be kept as aliases: Org Two", org2UUID))
+	}
+
+	assert.NoError(cypherDriver.Write(updatedOrg1, "TEST_TRANS_ID"))
+
+	storedOrg1, _, err := cypherDriver.Read(org1UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal([]string{"Org 2", "Proper Name 2"}, storedOrg1.(organisation).FormerNames)
+	assert.Equal([]string{"Org Two"}, storedOrg1.(organisation).Aliases)
+
+	result, err = cypherDriver.WriteOrganisation(updatedOrg1, writeOptions{}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(result.Changed, "rewriting the same payload should not drop the folded names")
+
+	renamedOrg1 := updatedOrg1
+	renamedOrg1.ProperName = "Renamed Proper Name 1"
+	assert.NoError(cypherDriver.Write(renamedOrg1, "TEST_TRANS_ID"))
+
+	storedOrg1, _, err = cypherDriver.Read(org1UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal("Renamed Proper Name 1", storedOrg1.(organisation).ProperName)
+	assert.Equal([]string{"Org 2", "Proper Name 2"}, storedOrg1.(organisation).FormerNames, "a later write should keep the folded names")
+	assert.Equal([]string{"Org Two", "Proper Name 1"}, storedOrg1.(organisation).Aliases, "a later write should keep the folded aliases")
+}
+
+func TestPreviewMergeOfOrganisations(t *testing.T) {
+	assert := assert.New(t)
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, concordedUUIDs)
+
+	assert.NoError(cypherDriver.Write(org1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org3, "TEST_TRANS_ID"))
+
+	_, found, err := cypherDriver.PreviewMerge(org1UUID, org9UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(found)
+
+	preview, found, err := cypherDriver.PreviewMerge(org1UUID, org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(org1, preview.Canonical)
+	assert.Equal(org2, *preview.Source)
+	assert.Equal([]movedRelationships{{Type: "SUB_ORGANISATION_OF", Direction: incomingDirection, Count: 1}}, preview.Relationships)
+	assert.Empty(preview.PlatformVersionCollisions)
+
+	conflictingFields := []string{}
+	for _, conflict := range preview.Conflicts {
+		conflictingFields = append(conflictingFields, conflict.Field)
+	}
+	assert.Equal([]string{"alternativeIdentifiers.TME", "alternativeIdentifiers.uuids", "parentOrganisation", "properName"}, conflictingFields)
+
+	// nothing is merged
+	_, found, err = cypherDriver.Read(org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+}
+
+// Relationships with the same platformVersion to the same node collapse into one
+func TestPreviewMergeListsPlatformVersionCollisions(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, concordedUUIDs)
+	cypherDriver := getCypherDriver(db)
+
+	annotationsRW := annotations.NewCypherAnnotationsService(cypherDriver.conn)
+
+	defer cleanDB(db, t, assert, concordedUUIDs)
+	defer deleteAllViaService(db, assert, annotationsRW)
+
+	assert.NoError(cypherDriver.Write(org1, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
+	writeJSONToService(annotationsRW, "./test-resources/annotationBodyForOrg2.json", contentUUID, assert)
+
+	addCanonicalAnnotationQuery := &neoism.CypherQuery{
+		Statement: `MATCH (c:Thing {uuid:{contentUUID}})-[r:ABOUT]->(:Thing {uuid:{sourceUUID}})
+					MATCH (o:Thing {uuid:{canonicalUUID}})
+					CREATE (c)-[:ABOUT {platformVersion: r.platformVersion}]->(o)`,
+		Parameters: map[string]interface{}{
+			"contentUUID":   contentUUID,
+			"sourceUUID":    org2UUID,
+			"canonicalUUID": org1UUID,
+		},
+	}
+	assert.NoError(cypherDriver.conn.CypherBatch([]*neoism.CypherQuery{addCanonicalAnnotationQuery}))
+
+	preview, found, err := cypherDriver.PreviewMerge(org1UUID, org2UUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	if assert.NotEmpty(preview.PlatformVersionCollisions) {
+		assert.Equal("ABOUT", preview.PlatformVersionCollisions[0].Type)
+		assert.Equal(incomingDirection, preview.PlatformVersionCollisions[0].Direction)
+		assert.Equal(contentUUID, preview.PlatformVersionCollisions[0].OtherUUID)
+	}
+}
+
 // Check that alternative nodes are deleted at concordence, but identifiers are kept
 func TestConcordeOrgsAndDeleteAlternativeNodes(t *testing.T) {
 	assert := assert.New(t)
@@ -348,9 +722,9 @@ func TestConcordeOrgsWithRelationshipPlatformVersionTransfer(t *testing.T) {
 
 	assert.NoError(cypherDriver.Write(org2, "TEST_TRANS_ID"))
 
-	relOrg2L, relOrg2R, err := getNodeRelationshipNames(cypherDriver.conn, org2UUID)
+	relOrg2L, relOrg2R, err := cypherDriver.getNodeRelationshipNames(org2UUID)
 	assert.Nil(err)
-	relOrg1L, relOrg1R, err := getNodeRelationshipNames(cypherDriver.conn, org1UUID)
+	relOrg1L, relOrg1R, err := cypherDriver.getNodeRelationshipNames(org1UUID)
 	assert.Empty(relOrg1L)
 	assert.Empty(relOrg1R)
 	assert.Nil(err)
@@ -370,7 +744,7 @@ func TestConcordeOrgsWithRelationshipPlatformVersionTransfer(t *testing.T) {
 	writeJSONToService(annotationsRW, "./test-resources/annotationBodyForOrg2.json", contentUUID, assert)
 	assert.NoError(cypherDriver.Write(updatedOrg1, "TEST_TRANS_ID"))
 
-	relUpdatedOrg1L, relUpdatedOrg1R, err := getNodeRelationshipNames(cypherDriver.conn, org1UUID)
+	relUpdatedOrg1L, relUpdatedOrg1R, err := cypherDriver.getNodeRelationshipNames(org1UUID)
 	assert.Nil(err)
 	for _, rel := range relOrg2L {
 		contains(relUpdatedOrg1L, rel.RelationshipType)
@@ -25,7 +25,7 @@ const (
 	fsIdentifierMinimal        = "identifierMinimalValue"
 	fsIdentifierOther          = "identifierOtherValue"
 	fsIdentifierAnother        = "anotherIdentifierValue"
-	leiCodeIdentifier          = "leiCodeIdentifier"
+	leiCodeIdentifier          = "549300U1OW41QPKYW028"
 	tmeIdentifier              = "tmeIdentifier"
 	tmeIdentifierAnother       = "tmeIdentifierAnother"
 )
@@ -172,6 +172,157 @@ func TestWriteWillUpdateOrg(t *testing.T) {
 	assert.NotEmpty(storedUpdatedOrg.(organisation).HiddenLabel, "Updated org should have a hidden label value")
 }
 
+func TestWriteSkipsUnchangedOrg(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	result, err := cypherDriver.WriteOrganisation(fullOrg, writeOptions{}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(result.Changed, "First write should have changed the org")
+
+	result, err = cypherDriver.WriteOrganisation(fullOrg, writeOptions{}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(result.Changed, "Writing the same org again should have been skipped")
+
+	result, err = cypherDriver.WriteOrganisation(fullOrg, writeOptions{Force: true}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(result.Changed, "Forced write should have rewritten the org")
+
+	updatedOrg := fullOrg
+	updatedOrg.PrefLabel = "Updated pref label"
+	result, err = cypherDriver.WriteOrganisation(updatedOrg, writeOptions{}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(result.Changed, "Write of a changed org should not have been skipped")
+
+	storedOrg, _, err := cypherDriver.Read(fullOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal(updatedOrg, storedOrg)
+}
+
+func TestWriteRejectsStaleRevision(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(minimalOrg, "TEST_TRANS_ID"))
+
+	_, revision, found, err := cypherDriver.ReadWithRevision(minimalOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(1, revision)
+
+	updatedOrg := minimalOrg
+	updatedOrg.ProperName = "Updated Name"
+	result, err := cypherDriver.WriteOrganisation(updatedOrg, writeOptions{IfMatchRevision: &revision}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal(2, result.Revision)
+
+	staleOrg := minimalOrg
+	staleOrg.ProperName = "Stale Name"
+	_, err = cypherDriver.WriteOrganisation(staleOrg, writeOptions{IfMatchRevision: &revision}, "TEST_TRANS_ID")
+	assert.IsType(preconditionFailedError{}, err)
+
+	storedOrg, revision, _, err := cypherDriver.ReadWithRevision(minimalOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal(updatedOrg, storedOrg)
+	assert.Equal(2, revision)
+}
+
+func TestWriteWithRevisionOfMissingOrgIsRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	revision := 1
+	_, err := cypherDriver.WriteOrganisation(minimalOrg, writeOptions{IfMatchRevision: &revision}, "TEST_TRANS_ID")
+	assert.IsType(preconditionFailedError{}, err)
+
+	_, err = cypherDriver.WriteOrganisation(minimalOrg, writeOptions{IfMatchAny: true}, "TEST_TRANS_ID")
+	assert.IsType(preconditionFailedError{}, err)
+
+	assert.NoError(cypherDriver.Write(minimalOrg, "TEST_TRANS_ID"))
+	updatedOrg := minimalOrg
+	updatedOrg.ProperName = "Updated Name"
+	result, err := cypherDriver.WriteOrganisation(updatedOrg, writeOptions{IfMatchAny: true}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(result.Changed)
+}
+
+func TestPatchOrg(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+
+	patch := map[string]interface{}{
+		"legalName": "Patched Legal Name",
+		"aliases":   map[string]interface{}{"add": []interface{}{"alias4"}},
+		"alternativeIdentifiers": map[string]interface{}{
+			"TME": map[string]interface{}{"remove": []interface{}{tmeIdentifier}},
+		},
+	}
+	result, found, err := cypherDriver.Patch(fullOrgUUID, patch, writeOptions{}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.True(result.Changed)
+
+	expected := fullOrg
+	expected.LegalName = "Patched Legal Name"
+	expected.Aliases = []string{"alias1", "alias2", "alias3", "alias4"}
+	expected.AlternativeIdentifiers.TME = []string{}
+
+	storedOrg, _, err := cypherDriver.Read(fullOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Equal(expected, storedOrg)
+}
+
+func TestPatchMissingOrg(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	_, found, err := cypherDriver.Patch(fullOrgUUID, map[string]interface{}{"legalName": "Patched"}, writeOptions{}, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(found)
+}
+
+func TestWriteRejectsParentCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+
+	parentOrg := organisation{
+		UUID:                   parentOrgUUID,
+		Type:                   Organisation,
+		ProperName:             "Parent Org",
+		AlternativeIdentifiers: alternativeIdentifiers{UUIDS: []string{parentOrgUUID}},
+		ParentOrganisation:     fullOrgUUID,
+	}
+	err := cypherDriver.Write(parentOrg, "TEST_TRANS_ID")
+	assert.IsType(requestError{}, err)
+	assert.Contains(err.(requestError).InvalidRequestDetails(), parentOrgUUID+" -> "+fullOrgUUID+" -> "+parentOrgUUID)
+
+	_, found, err := cypherDriver.Read(parentOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.False(found, "the parent should not have been written as an organisation")
+}
+
 func TestWritesOrgsWithEscapedCharactersInfields(t *testing.T) {
 	assert := assert.New(t)
 
@@ -231,6 +382,177 @@ func TestReadOrganisation(t *testing.T) {
 	assert.True(reflect.DeepEqual(fullOrg, storedOrg), fmt.Sprintf("organisations should be the same \n EXPECTED  %+v \n ACTUAL  %+v", fullOrg, storedOrg))
 }
 
+func TestReadByFactsetIdentifier(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+
+	orgs, err := cypherDriver.ReadByIdentifier("factset", fsIdentifier, "TEST_TRANS_ID")
+
+	assert.NoError(err, "Error finding organisation for factset identifier %s", fsIdentifier)
+	assert.Equal([]organisation{fullOrg}, orgs)
+}
+
+func TestWriteAndReadMarketIdentifiers(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	listed := fullOrg
+	listed.AlternativeIdentifiers.ISINs = []string{"US0378331005"}
+	listed.AlternativeIdentifiers.SEDOLs = []string{"2046251"}
+	listed.AlternativeIdentifiers.CUSIPs = []string{"037833100"}
+	listed.AlternativeIdentifiers.Tickers = []string{"XLON:0R2V", "XNAS:AAPL"}
+	assert.NoError(cypherDriver.Write(listed, "TEST_TRANS_ID"))
+
+	o, found, err := cypherDriver.Read(fullOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(listed, o)
+
+	for identifierType, value := range map[string]string{"isin": "US0378331005", "sedol": "2046251", "cusip": "037833100", "ticker": "XNAS:AAPL"} {
+		orgs, err := cypherDriver.ReadByIdentifier(identifierType, value, "TEST_TRANS_ID")
+		assert.NoError(err, identifierType)
+		assert.Equal([]organisation{listed}, orgs, identifierType)
+	}
+
+	orgs, err := cypherDriver.ReadByIdentifier("ticker", "XNYS:AAPL", "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Empty(orgs, "a ticker should only be found on its exchange")
+}
+
+func TestReadBySharedLeiCodeReturnsAllOrganisations(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(dupeLeiIdentifierOrg, "TEST_TRANS_ID"))
+
+	orgs, err := cypherDriver.ReadByIdentifier("lei", leiCodeIdentifier, "TEST_TRANS_ID")
+
+	assert.NoError(err, "Error finding organisations for lei code %s", leiCodeIdentifier)
+	assert.Len(orgs, 2)
+	assert.Equal(fullOrgUUID, orgs[0].UUID)
+	assert.Equal(dupeLeiIdentifierOrgUUID, orgs[1].UUID)
+}
+
+func TestReadByUnknownIdentifierReturnsNothing(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	orgs, err := cypherDriver.ReadByIdentifier("tme", tmeIdentifier, "TEST_TRANS_ID")
+
+	assert.NoError(err)
+	assert.Empty(orgs)
+}
+
+func TestReadByUnsupportedIdentifierType(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := service{}.ReadByIdentifier("isbn", "123", "TEST_TRANS_ID")
+
+	assert.IsType(requestError{}, err)
+}
+
+func TestListOrganisationsFilteredByTypeAndPrefLabelPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(minimalOrg, "TEST_TRANS_ID"))
+
+	hasParent := true
+	orgs, next, err := cypherDriver.List(listFilter{Type: PublicCompany, HasParent: &hasParent, PrefLabelPrefix: "Pref"}, "", 10, "TEST_TRANS_ID")
+
+	assert.NoError(err)
+	assert.Empty(next)
+	assert.Equal([]organisation{fullOrg}, orgs)
+}
+
+func TestListOrganisationsPaginatesInUUIDOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(dupeLeiIdentifierOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+
+	orgs, next, err := cypherDriver.List(listFilter{Type: Company, IncludeSubtypes: true}, "", 1, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Len(orgs, 1)
+	assert.Equal(fullOrgUUID, orgs[0].UUID)
+	assert.Equal(fullOrgUUID, next)
+
+	orgs, next, err = cypherDriver.List(listFilter{Type: Company, IncludeSubtypes: true}, next, 1, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Len(orgs, 1)
+	assert.Equal(dupeLeiIdentifierOrgUUID, orgs[0].UUID)
+	assert.Empty(next)
+}
+
+func TestListOrganisationsOfATypeLeavesOutItsSubtypes(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(dupeLeiIdentifierOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+
+	orgs, _, err := cypherDriver.List(listFilter{Type: Company}, "", 10, "TEST_TRANS_ID")
+	assert.NoError(err)
+	if assert.Len(orgs, 1) {
+		assert.Equal(dupeLeiIdentifierOrgUUID, orgs[0].UUID)
+	}
+
+	orgs, _, err = cypherDriver.List(listFilter{Type: Company, IncludeSubtypes: true}, "", 10, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.Len(orgs, 2)
+}
+
+func TestListOrganisationsMatchClauseExcludesSubtypes(t *testing.T) {
+	assert := assert.New(t)
+
+	clause := constructListOrganisationsMatchClause(listFilter{Type: Company}, defaultOrgTypes.subtypes(Company))
+
+	assert.Contains(clause, "o:Company AND NOT o:PublicCompany")
+}
+
+func TestListOrganisationsWithUnsupportedLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, limit := range []int{0, -1, maxListLimit + 1} {
+		_, _, err := service{}.List(listFilter{}, "", limit, "TEST_TRANS_ID")
+		assert.IsType(requestError{}, err, "%d", limit)
+	}
+}
+
+func TestListOrganisationsWithUnsupportedType(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := service{}.List(listFilter{Type: "Charity"}, "", 10, "TEST_TRANS_ID")
+
+	assert.IsType(requestError{}, err)
+}
+
 func TestDeleteNothing(t *testing.T) {
 	assert := assert.New(t)
 	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
@@ -336,6 +658,51 @@ func TestCount(t *testing.T) {
 	assert.Equal(2, count)
 }
 
+func TestIDsStreamsOrganisationsWithHashes(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(minimalOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+
+	fullOrgHash, err := hashOrganisation(fullOrg)
+	assert.NoError(err)
+	minimalOrgHash, err := hashOrganisation(minimalOrg)
+	assert.NoError(err)
+
+	entries := []rwapi.IDEntry{}
+	err = cypherDriver.IDs(func(entry rwapi.IDEntry) (bool, error) {
+		entries = append(entries, entry)
+		return true, nil
+	})
+
+	assert.NoError(err)
+	assert.Equal([]rwapi.IDEntry{{ID: minimalOrgUUID, Hash: minimalOrgHash}, {ID: fullOrgUUID, Hash: fullOrgHash}}, entries)
+}
+
+func TestIDsStopsWhenAskedTo(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	assert.NoError(cypherDriver.Write(minimalOrg, "TEST_TRANS_ID"))
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+
+	count := 0
+	err := cypherDriver.IDs(func(entry rwapi.IDEntry) (bool, error) {
+		count++
+		return false, nil
+	})
+
+	assert.NoError(err)
+	assert.Equal(1, count)
+}
+
 func doesThingExistAtAll(uuid string, db neoutils.NeoConnection, t *testing.T, assert *assert.Assertions) bool {
 	result := []struct {
 		Uuid string `json:"thing.uuid"`
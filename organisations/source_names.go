@@ -0,0 +1,113 @@
+package organisations
+
+import (
+	"encoding/json"
+
+	"github.com/jmcvetta/neoism"
+)
+
+// foldConcordedNames folds the names of the organisations concorded into o by earlier writes, then those of the merges
+// being planned. The earlier sources are read from the audits of their merges, so their names are kept however many
+// times the organisation is written again from a payload without them
+func (cd service) foldConcordedNames(o organisation, merges []plannedMerge) (organisation, []plannedMerge, error) {
+	sources, err := cd.readConcordedSources(o.UUID)
+	if err != nil {
+		return organisation{}, nil, err
+	}
+
+	earlier := make([]plannedMerge, len(sources))
+	for i := range sources {
+		earlier[i] = plannedMerge{SourceUUID: sources[i].UUID, Source: &sources[i]}
+	}
+
+	o, folded := foldSourceNames(o, append(earlier, merges...))
+	return o, folded[len(earlier):], nil
+}
+
+// readConcordedSources reads the organisations concorded into the canonical one, as they were before their merge,
+// oldest first. Those split back out by an unmerge no longer redirect to it, and are left out
+func (cd service) readConcordedSources(canonicalUUID string) ([]organisation, error) {
+	results := []struct {
+		Source string `json:"source"`
+	}{}
+
+	readQuery := &neoism.CypherQuery{
+		Statement: `MATCH (a:ConcordanceAudit {canonicalUUID: {uuid}})
+					WHERE a.source <> '' AND (:Redirect {uuid: a.sourceUUID})-[:REDIRECTS_TO]->(:Thing {uuid: {uuid}})
+					RETURN a.source as source
+					ORDER BY a.timestamp`,
+		Parameters: map[string]interface{}{
+			"uuid": canonicalUUID,
+		},
+		Result: &results,
+	}
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{readQuery}); err != nil {
+		return nil, err
+	}
+
+	sources := []organisation{}
+	for _, result := range results {
+		source := organisation{}
+		if err := json.Unmarshal([]byte(result.Source), &source); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// foldSourceNames keeps the names of the organisations being concorded away on the canonical one. The preferred, proper and
+// legal names of each source become former names and its aliases become aliases, unless the canonical organisation already
+// has them under any of its names. The merges are returned with the names folded from each of them
+func foldSourceNames(o organisation, merges []plannedMerge) (organisation, []plannedMerge) {
+	known := map[string]bool{}
+	for _, name := range organisationNames(o) {
+		known[name] = true
+	}
+
+	fold := func(names []string, into []string) ([]string, []string) {
+		folded := []string{}
+		for _, name := range names {
+			if name == "" || known[name] {
+				continue
+			}
+			known[name] = true
+			folded = append(folded, name)
+		}
+		return append(into, folded...), folded
+	}
+
+	// the payload lists are left untouched, as they may be shared with the caller
+	o.FormerNames = append([]string{}, o.FormerNames...)
+	o.Aliases = append([]string{}, o.Aliases...)
+
+	folded := make([]plannedMerge, len(merges))
+	for i, merge := range merges {
+		folded[i] = merge
+		if merge.Source == nil {
+			continue
+		}
+		source := merge.Source
+		o.FormerNames, folded[i].FoldedFormerNames = fold([]string{source.PrefLabel, source.ProperName, source.LegalName}, o.FormerNames)
+		o.Aliases, folded[i].FoldedAliases = fold(source.Aliases, o.Aliases)
+	}
+
+	if len(o.FormerNames) == 0 {
+		o.FormerNames = nil
+	}
+	if len(o.Aliases) == 0 {
+		o.Aliases = nil
+	}
+	return o, folded
+}
+
+// organisationNames returns every name the organisation is known by
+func organisationNames(o organisation) []string {
+	names := []string{o.PrefLabel, o.ProperName, o.LegalName, o.ShortName, o.HiddenLabel}
+	names = append(names, o.TradeNames...)
+	names = append(names, o.LocalNames...)
+	names = append(names, o.FormerNames...)
+	names = append(names, o.Aliases...)
+	return names
+}
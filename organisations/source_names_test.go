@@ -0,0 +1,97 @@
+package organisations
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jmcvetta/neoism"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedSources stands in for Neo4j holding the audits of earlier merges into an organisation
+type recordedSources struct {
+	sources []organisation
+}
+
+func (r *recordedSources) CypherBatch(queries []*neoism.CypherQuery) error {
+	results := []map[string]interface{}{}
+	for _, source := range r.sources {
+		b, err := json.Marshal(source)
+		if err != nil {
+			return err
+		}
+		results = append(results, map[string]interface{}{"source": string(b)})
+	}
+	b, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, queries[0].Result)
+}
+
+func (r *recordedSources) EnsureConstraints(constraints map[string]string) error {
+	return nil
+}
+
+func (r *recordedSources) EnsureIndexes(indexes map[string]string) error {
+	return nil
+}
+
+func TestFoldSourceNamesKeepsNewNamesOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	canonical := organisation{
+		UUID:        "canonical",
+		PrefLabel:   "Acme",
+		ProperName:  "Acme Ltd",
+		FormerNames: []string{"Acme Holdings"},
+		Aliases:     []string{"ACME"},
+	}
+	first := organisation{UUID: "first", PrefLabel: "Acme", ProperName: "Acme Holdings", LegalName: "Acme Widgets Limited", Aliases: []string{"ACME", "Widgets"}}
+	second := organisation{UUID: "second", ProperName: "Acme Widgets Limited", Aliases: []string{"Widgets", "AW"}}
+
+	folded, merges := foldSourceNames(canonical, []plannedMerge{
+		{SourceUUID: "first", Source: &first},
+		{SourceUUID: "gone"},
+		{SourceUUID: "second", Source: &second},
+	})
+
+	assert.Equal([]string{"Acme Holdings", "Acme Widgets Limited"}, folded.FormerNames)
+	assert.Equal([]string{"ACME", "Widgets", "AW"}, folded.Aliases)
+	assert.Equal([]string{"Acme Widgets Limited"}, merges[0].FoldedFormerNames)
+	assert.Equal([]string{"Widgets"}, merges[0].FoldedAliases)
+	assert.Empty(merges[1].FoldedFormerNames)
+	assert.Empty(merges[2].FoldedFormerNames)
+	assert.Equal([]string{"AW"}, merges[2].FoldedAliases)
+
+	assert.Equal([]string{"Acme Holdings"}, canonical.FormerNames, "the payload should be left untouched")
+	assert.Equal([]string{"ACME"}, canonical.Aliases, "the payload should be left untouched")
+}
+
+func TestFoldSourceNamesWithoutNamesLeavesListsUnset(t *testing.T) {
+	assert := assert.New(t)
+
+	folded, _ := foldSourceNames(organisation{UUID: "canonical", PrefLabel: "Acme"}, []plannedMerge{{SourceUUID: "gone"}})
+	assert.Nil(folded.FormerNames)
+	assert.Nil(folded.Aliases)
+}
+
+func TestFoldConcordedNamesKeepsThoseOfEarlierMerges(t *testing.T) {
+	assert := assert.New(t)
+
+	earlier := organisation{UUID: "earlier", PrefLabel: "Acme Holdings", ProperName: "Acme Holdings", Aliases: []string{"AH"}}
+	cd := NewCypherOrganisationService(&recordedSources{sources: []organisation{earlier}}, Config{FoldSourceNames: true})
+
+	canonical := organisation{UUID: "canonical", PrefLabel: "Acme", ProperName: "Acme Ltd"}
+	current := organisation{UUID: "current", PrefLabel: "Acme Widgets", ProperName: "Acme Holdings", Aliases: []string{"AW"}}
+
+	folded, merges, err := cd.foldConcordedNames(canonical, []plannedMerge{{SourceUUID: "current", Source: &current}})
+	assert.NoError(err)
+	assert.Equal([]string{"Acme Holdings", "Acme Widgets"}, folded.FormerNames)
+	assert.Equal([]string{"AH", "AW"}, folded.Aliases)
+	if assert.Len(merges, 1, "only the merges being planned should be returned") {
+		assert.Equal("current", merges[0].SourceUUID)
+		assert.Equal([]string{"Acme Widgets"}, merges[0].FoldedFormerNames)
+		assert.Equal([]string{"AW"}, merges[0].FoldedAliases)
+	}
+}
@@ -0,0 +1,185 @@
+package organisations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelRegex matches the labels a type may have, which are written into Cypher statements as they are
+var labelRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// OrgTypes is the registry of organisation types. Each type has a label chain, from its own label up to Thing,
+// which are the labels of its nodes. A chain goes through Organisation and Concept, and through the chains of
+// the types it specialises
+type OrgTypes map[OrgType][]string
+
+// defaultOrgTypes are the types every deployment supports
+var defaultOrgTypes = OrgTypes{
+	Organisation:  {"Organisation", "Concept", "Thing"},
+	Company:       {"Company", "Organisation", "Concept", "Thing"},
+	PublicCompany: {"PublicCompany", "Company", "Organisation", "Concept", "Thing"},
+}
+
+// LoadOrgTypes reads organisation types from a JSON object mapping each type to its label chain, such as
+// {"Charity": ["Charity", "Organisation", "Concept", "Thing"]}. They are added to the default types
+func LoadOrgTypes(r io.Reader) (OrgTypes, error) {
+	loaded := OrgTypes{}
+	if err := json.NewDecoder(r).Decode(&loaded); err != nil {
+		return nil, fmt.Errorf("Invalid organisation types: %s", err.Error())
+	}
+
+	types := OrgTypes{}
+	for orgType, labels := range defaultOrgTypes {
+		types[orgType] = labels
+	}
+	for orgType, labels := range loaded {
+		if defaults, ok := defaultOrgTypes[orgType]; ok && strings.Join(defaults, ":") != strings.Join(labels, ":") {
+			return nil, fmt.Errorf("Invalid organisation types: %s cannot be redefined", orgType)
+		}
+		types[orgType] = labels
+	}
+
+	if err := types.check(); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+// check makes sure every label chain is well formed, and agrees with the chains of the types it goes through
+func (t OrgTypes) check() error {
+	for _, name := range t.names() {
+		orgType := OrgType(name)
+		labels := t[orgType]
+		problem := ""
+		switch {
+		case len(labels) == 0 || labels[0] != name:
+			problem = "should start with the type itself"
+		case labels[len(labels)-1] != "Thing":
+			problem = "should end with Thing"
+		case !containsString(labels, "Organisation") || !containsString(labels, "Concept"):
+			problem = "should go through Organisation and Concept"
+		}
+		for i, label := range labels {
+			if problem != "" {
+				break
+			}
+			if !labelRegex.MatchString(label) {
+				problem = fmt.Sprintf("has the invalid label '%s'", label)
+			} else if containsString(labels[:i], label) {
+				problem = fmt.Sprintf("has the label %s twice", label)
+			} else if chain, ok := t[OrgType(label)]; ok && i > 0 && strings.Join(chain, ":") != strings.Join(labels[i:], ":") {
+				problem = fmt.Sprintf("goes through %s, but not up its chain %s", label, strings.Join(chain, ":"))
+			}
+		}
+		if problem != "" {
+			return fmt.Errorf("Invalid organisation types: the labels %s of %s %s", strings.Join(labels, ":"), orgType, problem)
+		}
+	}
+	return nil
+}
+
+// names returns the types in alphabetical order
+func (t OrgTypes) names() []string {
+	names := []string{}
+	for orgType := range t {
+		names = append(names, string(orgType))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// labels returns the label chain of the type, failing if the type is not known
+func (t OrgTypes) labels(orgType OrgType) ([]string, error) {
+	labels, ok := t[orgType]
+	if !ok {
+		names := t.names()
+		return nil, fmt.Errorf("type: '%s' is not supported, it should be one of %s or %s", orgType, strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+	return labels, nil
+}
+
+// subtypes returns the types specialising the type, whose label chains go through it, in alphabetical order
+func (t OrgTypes) subtypes(orgType OrgType) []string {
+	subtypes := []string{}
+	for _, name := range t.names() {
+		if OrgType(name) != orgType && containsString(t[OrgType(name)], string(orgType)) {
+			subtypes = append(subtypes, name)
+		}
+	}
+	return subtypes
+}
+
+// removableLabels returns every label any type gives a node, apart from Thing, which is what an organisation node
+// keeps when its type changes or it is deleted
+func (t OrgTypes) removableLabels() []string {
+	labels := []string{}
+	for _, chain := range t {
+		for _, label := range chain {
+			if label != "Thing" && !containsString(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// typeOf works out the type of a node from its labels: the most specific type, with the longest label chain, whose
+// labels the node all has. Labels which belong to no type, such as markers added by other writers, do not change it,
+// and are returned so they can be reported
+func (t OrgTypes) typeOf(labels []string) (OrgType, []string) {
+	var orgType OrgType
+	for _, name := range t.names() {
+		chain := t[OrgType(name)]
+		if containsAll(labels, chain) && (orgType == "" || len(chain) > len(t[orgType])) {
+			orgType = OrgType(name)
+		}
+	}
+
+	known := t.removableLabels()
+	unknown := []string{}
+	for _, label := range labels {
+		if label != "Thing" && !containsString(known, label) {
+			unknown = append(unknown, label)
+		}
+	}
+	return orgType, unknown
+}
+
+// readType returns the type of the organisation read with the labels, along with the labels which belong to no type,
+// or nil when there are none
+func (t OrgTypes) readType(labels []string) (OrgType, []string) {
+	orgType, unknown := t.typeOf(labels)
+	if len(unknown) == 0 {
+		return orgType, nil
+	}
+	return orgType, unknown
+}
+
+func containsAll(items []string, wanted []string) bool {
+	for _, item := range wanted {
+		if !containsString(items, item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t OrgTypes) validateType(o organisation) []string {
+	if _, err := t.labels(o.Type); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// orgTypes returns the configured organisation types, or the default ones
+func (c Config) orgTypes() OrgTypes {
+	if len(c.OrgTypes) == 0 {
+		return defaultOrgTypes
+	}
+	return c.OrgTypes
+}
@@ -0,0 +1,225 @@
+package organisations
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/annotations-rw-neo4j/annotations"
+	"github.com/jmcvetta/neoism"
+	"github.com/stretchr/testify/assert"
+)
+
+const charityTypes = `{
+	"Charity": ["Charity", "Organisation", "Concept", "Thing"],
+	"NGO": ["NGO", "Charity", "Organisation", "Concept", "Thing"]
+}`
+
+func TestLoadOrgTypesAddsToTheDefaultTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	types, err := LoadOrgTypes(strings.NewReader(charityTypes))
+	assert.NoError(err)
+
+	assert.Equal([]string{"Charity", "Company", "NGO", "Organisation", "PublicCompany"}, types.names())
+	labels, err := types.labels("NGO")
+	assert.NoError(err)
+	assert.Equal([]string{"NGO", "Charity", "Organisation", "Concept", "Thing"}, labels)
+	assert.Equal([]string{"Charity", "Company", "Concept", "NGO", "Organisation", "PublicCompany"}, types.removableLabels())
+}
+
+func TestLoadOrgTypesRejectsBadLabelChains(t *testing.T) {
+	assert := assert.New(t)
+
+	for problem, config := range map[string]string{
+		"should start with the type itself":          `{"Charity": ["Organisation", "Concept", "Thing"]}`,
+		"should end with Thing":                      `{"Charity": ["Charity", "Organisation", "Concept"]}`,
+		"should go through Organisation and Concept": `{"Charity": ["Charity", "Thing"]}`,
+		"has the invalid label 'Good Cause'":         `{"Charity": ["Charity", "Good Cause", "Organisation", "Concept", "Thing"]}`,
+		"has the label Concept twice":                `{"Charity": ["Charity", "Concept", "Organisation", "Concept", "Thing"]}`,
+		"goes through Company, but not up its chain": `{"Charity": ["Charity", "Company", "Concept", "Organisation", "Thing"]}`,
+		"Company cannot be redefined":                `{"Company": ["Company", "Organisation", "Concept", "Thing", "Entity"]}`,
+		"Invalid organisation types":                 `["Charity"]`,
+	} {
+		_, err := LoadOrgTypes(strings.NewReader(config))
+		if assert.Error(err, problem) {
+			assert.Contains(err.Error(), problem)
+		}
+	}
+}
+
+func TestValidationAcceptsConfiguredTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	types, err := LoadOrgTypes(strings.NewReader(charityTypes))
+	assert.NoError(err)
+
+	charity := minimalOrg
+	charity.Type = "Charity"
+	assert.NoError(validateOrganisation(charity, types))
+	assert.Equal(requestError{"type: 'Charity' is not supported, it should be one of Company, Organisation or PublicCompany"}, validateOrganisation(charity, defaultOrgTypes))
+}
+
+func TestWriteSetsTheLabelsOfTheType(t *testing.T) {
+	assert := assert.New(t)
+
+	types, err := LoadOrgTypes(strings.NewReader(charityTypes))
+	assert.NoError(err)
+	cd := NewCypherOrganisationService(nil, Config{OrgTypes: types})
+
+	ngo := minimalOrg
+	ngo.Type = "NGO"
+	ngo.AlternativeIdentifiers.UUIDS = nil
+	queries, _, err := cd.constructWriteOrganisationQueries(ngo, "hash", "TEST_TRANS_ID")
+	assert.NoError(err)
+
+	statements := []string{}
+	for _, query := range queries {
+		statements = append(statements, query.Statement)
+	}
+	assert.Contains(strings.Join(statements, "\n"), "REMOVE o:Charity:Company:Concept:NGO:Organisation:PublicCompany")
+	assert.Contains(strings.Join(statements, "\n"), "set o : NGO:Charity:Organisation:Concept:Thing")
+}
+
+func TestDeleteRemovesTheLabelsOfConfiguredTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	defer cleanDB(db, t, assert, uuidsToClean)
+
+	types, err := LoadOrgTypes(strings.NewReader(charityTypes))
+	assert.NoError(err)
+	cypherDriver := NewCypherOrganisationService(db, Config{BatchSize: 1024, OrgTypes: types})
+	assert.NoError(cypherDriver.Initialise())
+
+	charity := fullOrg
+	charity.Type = "Charity"
+	assert.NoError(cypherDriver.Write(charity, "TEST_TRANS_ID"))
+
+	// an annotation keeps the node once the organisation is deleted
+	writeJSONToService(annotations.NewCypherAnnotationsService(cypherDriver.conn), "./test-resources/singleAnnotationForFullOrg.json", contentUUID, assert)
+	found, err := cypherDriver.Delete(fullOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+
+	result := []struct {
+		Labels []string `json:"labels"`
+	}{}
+	assert.NoError(db.CypherBatch([]*neoism.CypherQuery{{
+		Statement:  `MATCH (t:Thing {uuid:{uuid}}) RETURN labels(t) as labels`,
+		Parameters: map[string]interface{}{"uuid": fullOrgUUID},
+		Result:     &result,
+	}}))
+	if assert.Len(result, 1) {
+		assert.Equal([]string{"Thing"}, result[0].Labels)
+	}
+}
+
+func TestSubtypesGoThroughTheType(t *testing.T) {
+	assert := assert.New(t)
+
+	types, err := LoadOrgTypes(strings.NewReader(charityTypes))
+	assert.NoError(err)
+
+	assert.Equal([]string{"Charity", "Company", "NGO", "PublicCompany"}, types.subtypes(Organisation))
+	assert.Equal([]string{"PublicCompany"}, types.subtypes(Company))
+	assert.Equal([]string{"NGO"}, types.subtypes("Charity"))
+	assert.Empty(types.subtypes(PublicCompany))
+}
+
+func TestTypeOfLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	types, err := LoadOrgTypes(strings.NewReader(charityTypes))
+	assert.NoError(err)
+
+	for _, test := range []struct {
+		labels   []string
+		expected OrgType
+		unknown  []string
+	}{
+		{[]string{"Thing", "Concept", "Organisation"}, Organisation, []string{}},
+		{[]string{"Company", "Thing", "Organisation", "Concept"}, Company, []string{}},
+		{[]string{"Thing", "Concept", "Organisation", "Company", "PublicCompany"}, PublicCompany, []string{}},
+		{[]string{"Thing", "Concept", "Organisation", "Curated", "Company"}, Company, []string{"Curated"}},
+		{[]string{"Thing", "Concept", "Organisation", "Charity", "NGO", "Curated", "Reviewed"}, "NGO", []string{"Curated", "Reviewed"}},
+		{[]string{"Thing", "Concept", "Organisation", "PublicCompany"}, Organisation, []string{}},
+		{[]string{"Thing", "Concept"}, "", []string{}},
+	} {
+		orgType, unknown := types.typeOf(test.labels)
+		assert.Equal(test.expected, orgType, "%v", test.labels)
+		assert.Equal(test.unknown, unknown, "%v", test.labels)
+	}
+}
+
+// labelledOrganisation stands in for Neo4j when reading an organisation, answering with one having the labels
+type labelledOrganisation struct {
+	labels []string
+}
+
+func (f labelledOrganisation) CypherBatch(queries []*neoism.CypherQuery) error {
+	for _, query := range queries {
+		if results, ok := query.Result.(*[]organisationResult); ok {
+			*results = []organisationResult{{UUID: fullOrgUUID, Type: f.labels}}
+		}
+	}
+	return nil
+}
+
+func (f labelledOrganisation) EnsureConstraints(constraints map[string]string) error {
+	return nil
+}
+
+func (f labelledOrganisation) EnsureIndexes(indexes map[string]string) error {
+	return nil
+}
+
+func TestReadTypeReturnsLabelsOfOtherWriters(t *testing.T) {
+	assert := assert.New(t)
+
+	orgType, unknown := defaultOrgTypes.readType([]string{"Thing", "Concept", "Organisation", "Curated", "Company", "Reviewed"})
+	assert.Equal(Company, orgType)
+	assert.Equal([]string{"Curated", "Reviewed"}, unknown)
+
+	orgType, unknown = defaultOrgTypes.readType([]string{"Thing", "Concept", "Organisation"})
+	assert.Equal(Organisation, orgType)
+	assert.Nil(unknown)
+}
+
+func TestGetOrganisationListsLabelsOfOtherWriters(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := NewCypherOrganisationService(labelledOrganisation{[]string{"Thing", "Concept", "Organisation", "Curated", "Reviewed"}}, Config{})
+	rec := serveRequestWithBody(svc, "GET", "/organisations/"+fullOrgUUID, "")
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("Curated, Reviewed", rec.Header().Get(unknownLabelsHeader))
+	assert.NotContains(rec.Body.String(), "Curated")
+
+	svc = NewCypherOrganisationService(labelledOrganisation{[]string{"Thing", "Concept", "Organisation"}}, Config{})
+	rec = serveRequestWithBody(svc, "GET", "/organisations/"+fullOrgUUID, "")
+
+	assert.Equal(http.StatusOK, rec.Code)
+	_, listed := rec.Header()[unknownLabelsHeader]
+	assert.False(listed)
+}
+
+func TestReadTypeIgnoresLabelsOfOtherWriters(t *testing.T) {
+	assert := assert.New(t)
+
+	db := getDatabaseConnectionAndCheckClean(t, assert, uuidsToClean)
+	defer cleanDB(db, t, assert, uuidsToClean)
+	cypherDriver := getCypherDriver(db)
+
+	assert.NoError(cypherDriver.Write(fullOrg, "TEST_TRANS_ID"))
+	assert.NoError(db.CypherBatch([]*neoism.CypherQuery{{
+		Statement:  `MATCH (o:Thing {uuid:{uuid}}) SET o:Curated`,
+		Parameters: map[string]interface{}{"uuid": fullOrgUUID},
+	}}))
+
+	o, found, err := cypherDriver.Read(fullOrgUUID, "TEST_TRANS_ID")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(fullOrg.Type, o.(organisation).Type)
+	assert.Equal([]string{"Curated"}, o.(organisation).UnknownLabels)
+}
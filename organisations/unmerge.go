@@ -0,0 +1,234 @@
+package organisations
+
+import (
+	"fmt"
+
+	"github.com/jmcvetta/neoism"
+)
+
+//Unmerge - Splits an organisation concorded into another one back out, using the record of its merge. The source organisation
+//is recreated as it was before the merge, the relationships moved from it are moved back, and its uuid is removed from the UPP
+//identifiers of the canonical organisation. Source identifiers which are now held by other nodes are left with them.
+//The unmerge is refused with a concurrentWriteError while another write has either uuid
+func (cd service) Unmerge(sourceUUID string, transId string) (unmergeResult, bool, error) {
+	canonicalUUID, redirected, err := cd.ReadRedirect(sourceUUID, transId)
+	if err != nil || !redirected {
+		return unmergeResult{}, false, err
+	}
+
+	lock, err := cd.lockUUIDs([]string{canonicalUUID, sourceUUID})
+	if err != nil {
+		return unmergeResult{}, true, err
+	}
+	defer cd.unlock(lock)
+
+	// another write may have moved the redirect before the uuids were locked
+	lockedCanonicalUUID, redirected, err := cd.ReadRedirect(sourceUUID, transId)
+	if err != nil || !redirected {
+		return unmergeResult{}, redirected, err
+	}
+	if lockedCanonicalUUID != canonicalUUID {
+		return unmergeResult{}, true, concurrentWriteError{fmt.Sprintf("Organisation %s was concorded into %s while it was being unmerged, retry to unmerge it from there", sourceUUID, lockedCanonicalUUID)}
+	}
+
+	audits, err := cd.ConcordanceAudits(sourceUUID, transId)
+	if err != nil {
+		return unmergeResult{}, true, err
+	}
+
+	// the latest record is the one of the merge being undone
+	var source *organisation
+	for _, audit := range audits {
+		if audit.SourceUUID == sourceUUID && audit.Source != nil {
+			source = audit.Source
+		}
+	}
+	if source == nil {
+		return unmergeResult{}, true, requestError{fmt.Sprintf("There is no record of organisation %s as it was before it was concorded into %s", sourceUUID, canonicalUUID)}
+	}
+
+	restored, retained, err := cd.withoutIdentifiersInUse(*source)
+	if err != nil {
+		return unmergeResult{}, true, err
+	}
+
+	hash, err := hashOrganisation(restored)
+	if err != nil {
+		return unmergeResult{}, true, err
+	}
+
+	relationshipsFromCanonical, relationshipsToCanonical, err := cd.readConcordedRelationships(canonicalUUID, sourceUUID)
+	if err != nil {
+		return unmergeResult{}, true, err
+	}
+
+	queries := []*neoism.CypherQuery{constructRemoveConcordedUUIDQuery(canonicalUUID, sourceUUID)}
+
+	writeQueries, _, err := cd.constructWriteOrganisationQueries(restored, hash, transId)
+	if err != nil {
+		return unmergeResult{}, true, err
+	}
+	queries = append(queries, writeQueries...)
+
+	result := unmergeResult{
+		CanonicalUUID:       canonicalUUID,
+		SourceUUID:          sourceUUID,
+		Relationships:       []movedRelationships{},
+		RetainedIdentifiers: retained,
+	}
+	for _, rel := range relationshipsFromCanonical {
+		queries = append(queries, constructMoveBackRelationshipsFromNodeQuery(canonicalUUID, sourceUUID, rel.RelationshipType))
+		result.Relationships = append(result.Relationships, movedRelationships{Type: rel.RelationshipType, Direction: outgoingDirection, Count: rel.Count})
+	}
+	for _, rel := range relationshipsToCanonical {
+		queries = append(queries, constructMoveBackRelationshipsToNodeQuery(canonicalUUID, sourceUUID, rel.RelationshipType))
+		result.Relationships = append(result.Relationships, movedRelationships{Type: rel.RelationshipType, Direction: incomingDirection, Count: rel.Count})
+	}
+
+	if err := cd.writeBatch(queries); err != nil {
+		return unmergeResult{}, true, err
+	}
+	return result, true, nil
+}
+
+// withoutIdentifiersInUse drops the unique identifiers of the organisation which now identify another node, returning them
+// separately. Its own UPP identifier is kept, as the unmerge removes it from the canonical organisation
+func (cd service) withoutIdentifiersInUse(o organisation) (organisation, []identifierValue, error) {
+	candidates := []map[string]interface{}{}
+	addCandidate := func(label string, value string) {
+		candidates = append(candidates, map[string]interface{}{"label": label, "value": value})
+	}
+	for _, uuid := range o.AlternativeIdentifiers.UUIDS {
+		if uuid != o.UUID {
+			addCandidate(uppIdentifierLabel, uuid)
+		}
+	}
+	for _, tme := range o.AlternativeIdentifiers.TME {
+		addCandidate(tmeIdentifierLabel, tme)
+	}
+	if o.AlternativeIdentifiers.FactsetIdentifier != "" {
+		addCandidate(factsetIdentifierLabel, o.AlternativeIdentifiers.FactsetIdentifier)
+	}
+	for _, market := range marketIdentifiers {
+		for _, value := range *market.list(&o.AlternativeIdentifiers) {
+			addCandidate(market.label, value)
+		}
+	}
+
+	inUse := []identifierValue{}
+	inUseQuery := &neoism.CypherQuery{
+		Statement: `UNWIND {identifiers} AS id
+					MATCH (i:Identifier {value: id.value})
+					WHERE id.label IN labels(i)
+					RETURN DISTINCT id.label as label, id.value as value`,
+		Parameters: map[string]interface{}{
+			"identifiers": candidates,
+		},
+		Result: &inUse,
+	}
+
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{inUseQuery}); err != nil {
+		return organisation{}, nil, err
+	}
+
+	isInUse := func(label string, value string) bool {
+		for _, id := range inUse {
+			if id.Label == label && id.Value == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	restored := o
+	restored.AlternativeIdentifiers.UUIDS = []string{}
+	for _, uuid := range o.AlternativeIdentifiers.UUIDS {
+		if uuid == o.UUID || !isInUse(uppIdentifierLabel, uuid) {
+			restored.AlternativeIdentifiers.UUIDS = append(restored.AlternativeIdentifiers.UUIDS, uuid)
+		}
+	}
+	restored.AlternativeIdentifiers.TME = []string{}
+	for _, tme := range o.AlternativeIdentifiers.TME {
+		if !isInUse(tmeIdentifierLabel, tme) {
+			restored.AlternativeIdentifiers.TME = append(restored.AlternativeIdentifiers.TME, tme)
+		}
+	}
+	if isInUse(factsetIdentifierLabel, o.AlternativeIdentifiers.FactsetIdentifier) {
+		restored.AlternativeIdentifiers.FactsetIdentifier = ""
+	}
+	for _, market := range marketIdentifiers {
+		available := []string{}
+		for _, value := range *market.list(&o.AlternativeIdentifiers) {
+			if !isInUse(market.label, value) {
+				available = append(available, value)
+			}
+		}
+		*market.list(&restored.AlternativeIdentifiers) = available
+	}
+
+	return restored, inUse, nil
+}
+
+// readConcordedRelationships reads the types of the relationships of the canonical node which were moved from the source node
+func (cd service) readConcordedRelationships(canonicalUUID string, sourceUUID string) (relationships, relationships, error) {
+	relationshipsFromNode := relationships{}
+	relationshipsToNode := relationships{}
+
+	params := map[string]interface{}{
+		"canonicalUUID": canonicalUUID,
+		"sourceUUID":    sourceUUID,
+	}
+	readQueries := []*neoism.CypherQuery{
+		{
+			Statement: `MATCH (c:Thing {uuid:{canonicalUUID}})-[r]->()
+						WHERE r.concordedFrom = {sourceUUID}
+						RETURN type(r) as relationship, count(r) as count`,
+			Parameters: params,
+			Result:     &relationshipsFromNode,
+		},
+		{
+			Statement: `MATCH (c:Thing {uuid:{canonicalUUID}})<-[r]-()
+						WHERE r.concordedFrom = {sourceUUID}
+						RETURN type(r) as relationship, count(r) as count`,
+			Parameters: params,
+			Result:     &relationshipsToNode,
+		},
+	}
+
+	if err := cd.conn.CypherBatch(readQueries); err != nil {
+		return nil, nil, err
+	}
+	return relationshipsFromNode, relationshipsToNode, nil
+}
+
+func constructMoveBackRelationshipsFromNodeQuery(canonicalUUID string, sourceUUID string, predicate string) *neoism.CypherQuery {
+	return &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (c:Thing {uuid:{canonicalUUID}})-[oldRel:%s]->(p)
+					WHERE oldRel.concordedFrom = {sourceUUID}
+					MATCH (s:Thing {uuid:{sourceUUID}})
+					CREATE (s)-[newRel:%s]->(p)
+					SET newRel = oldRel
+					REMOVE newRel.concordedFrom
+					DELETE oldRel`, predicate, predicate),
+		Parameters: map[string]interface{}{
+			"canonicalUUID": canonicalUUID,
+			"sourceUUID":    sourceUUID,
+		},
+	}
+}
+
+func constructMoveBackRelationshipsToNodeQuery(canonicalUUID string, sourceUUID string, predicate string) *neoism.CypherQuery {
+	return &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (c:Thing {uuid:{canonicalUUID}})<-[oldRel:%s]-(p)
+					WHERE oldRel.concordedFrom = {sourceUUID}
+					MATCH (s:Thing {uuid:{sourceUUID}})
+					CREATE (s)<-[newRel:%s]-(p)
+					SET newRel = oldRel
+					REMOVE newRel.concordedFrom
+					DELETE oldRel`, predicate, predicate),
+		Parameters: map[string]interface{}{
+			"canonicalUUID": canonicalUUID,
+			"sourceUUID":    sourceUUID,
+		},
+	}
+}
@@ -0,0 +1,141 @@
+package organisations
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jmcvetta/neoism"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUnmergeDB stands in for Neo4j when unmerging: it holds the redirects of concorded uuids, the audits of their
+// merges, and the identifiers held by other nodes
+type fakeUnmergeDB struct {
+	redirects   map[string]string
+	audits      []map[string]interface{}
+	inUse       []identifierValue
+	identifiers []map[string]interface{}
+}
+
+func (f *fakeUnmergeDB) CypherBatch(queries []*neoism.CypherQuery) error {
+	for _, query := range queries {
+		var results interface{}
+		switch {
+		case strings.HasPrefix(query.Statement, "MATCH (:Redirect {uuid:{uuid}})"):
+			rows := []map[string]interface{}{}
+			if canonicalUUID, ok := f.redirects[query.Parameters["uuid"].(string)]; ok {
+				rows = append(rows, map[string]interface{}{"uuid": canonicalUUID})
+			}
+			results = rows
+		case strings.HasPrefix(query.Statement, "MATCH (a:ConcordanceAudit)"):
+			results = f.audits
+		case strings.HasPrefix(query.Statement, "UNWIND {identifiers} AS id"):
+			f.identifiers = query.Parameters["identifiers"].([]map[string]interface{})
+			results = f.inUse
+		default:
+			continue
+		}
+		b, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, query.Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeUnmergeDB) EnsureConstraints(constraints map[string]string) error {
+	return nil
+}
+
+func (f *fakeUnmergeDB) EnsureIndexes(indexes map[string]string) error {
+	return nil
+}
+
+func TestWithoutIdentifiersInUseDropsThoseHeldElsewhere(t *testing.T) {
+	assert := assert.New(t)
+
+	db := &fakeUnmergeDB{inUse: []identifierValue{
+		{Label: uppIdentifierLabel, Value: org3UUID},
+		{Label: tmeIdentifierLabel, Value: "tme taken"},
+		{Label: factsetIdentifierLabel, Value: "factset taken"},
+		{Label: isinIdentifierLabel, Value: "US0378331005"},
+	}}
+	cd := NewCypherOrganisationService(db, Config{})
+
+	source := organisation{
+		UUID: org2UUID,
+		AlternativeIdentifiers: alternativeIdentifiers{
+			UUIDS:             []string{org2UUID, org3UUID},
+			TME:               []string{"tme taken", "tme free"},
+			FactsetIdentifier: "factset taken",
+			LeiCode:           "lei",
+			ISINs:             []string{"US0378331005", "GB0002634946"},
+			Tickers:           []string{"XNAS:AAPL"},
+		},
+	}
+
+	restored, retained, err := cd.withoutIdentifiersInUse(source)
+	assert.NoError(err)
+	assert.Equal(db.inUse, retained)
+	assert.Equal(alternativeIdentifiers{
+		UUIDS:   []string{org2UUID},
+		TME:     []string{"tme free"},
+		LeiCode: "lei",
+		ISINs:   []string{"GB0002634946"},
+		SEDOLs:  []string{},
+		CUSIPs:  []string{},
+		Tickers: []string{"XNAS:AAPL"},
+	}, restored.AlternativeIdentifiers)
+	assert.Equal([]string{org2UUID, org3UUID}, source.AlternativeIdentifiers.UUIDS, "the source should be left untouched")
+	assert.Equal([]string{"tme taken", "tme free"}, source.AlternativeIdentifiers.TME, "the source should be left untouched")
+
+	for _, identifier := range db.identifiers {
+		assert.NotEqual(org2UUID, identifier["value"], "its own uuid should not be looked up")
+	}
+}
+
+func TestUnmergeOfOrganisationNotConcordedIsNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := NewCypherOrganisationService(&fakeUnmergeDB{}, Config{})
+	rec := serveRequestWithBody(svc, "POST", "/organisations/"+org2UUID+"/__unmerge", "")
+
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.Contains(rec.Body.String(), org2UUID+" is not concorded into another organisation")
+}
+
+func TestUnmergeWithoutRecordOfTheSourceIsRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	db := &fakeUnmergeDB{
+		redirects: map[string]string{org2UUID: org1UUID},
+		audits: []map[string]interface{}{
+			{"canonicalUUID": org1UUID, "sourceUUID": org2UUID, "relationships": "[]", "source": ""},
+		},
+	}
+	svc := NewCypherOrganisationService(db, Config{})
+	rec := serveRequestWithBody(svc, "POST", "/organisations/"+org2UUID+"/__unmerge", "")
+
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), "There is no record of organisation "+org2UUID)
+}
+
+func TestUnmergeRefusedWhileAnotherWriteHoldsTheCanonicalUUID(t *testing.T) {
+	assert := assert.New(t)
+
+	unlock, err := writeLocks.tryLock([]string{org1UUID})
+	assert.NoError(err)
+	defer unlock()
+
+	svc := NewCypherOrganisationService(&fakeUnmergeDB{redirects: map[string]string{org2UUID: org1UUID}}, Config{})
+	rec := serveRequestWithBody(svc, "POST", "/organisations/"+org2UUID+"/__unmerge", "")
+
+	assert.Equal(http.StatusConflict, rec.Code)
+	assert.Equal("1", rec.Header().Get("Retry-After"))
+	assert.Contains(rec.Body.String(), org1UUID)
+}
@@ -1,6 +1,7 @@
 package organisations
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/Financial-Times/neo-utils-go/neoutils"
 	"github.com/jmcvetta/neoism"
@@ -23,7 +24,7 @@ func getDatabaseConnection(assert *assert.Assertions) neoutils.NeoConnection {
 }
 
 func getCypherDriver(db neoutils.NeoConnection) service {
-	cr := NewCypherOrganisationService(db)
+	cr := NewCypherOrganisationService(db, Config{BatchSize: 1024})
 	cr.Initialise()
 	return cr
 }
@@ -62,6 +63,8 @@ func cleanDB(db neoutils.CypherRunner, t *testing.T, assert *assert.Assertions,
 	for _, uuid := range uuidsToClean {
 		qs = append(qs, &neoism.CypherQuery{Statement: fmt.Sprintf("MATCH (org:Thing {uuid: '%v'})<-[:IDENTIFIES*0..]-(i:Identifier) DETACH DELETE org, i", uuid)})
 		qs = append(qs, &neoism.CypherQuery{Statement: fmt.Sprintf("MATCH (org:Thing {uuid: '%v'}) DETACH DELETE org", uuid)})
+		qs = append(qs, &neoism.CypherQuery{Statement: fmt.Sprintf("MATCH (r:Redirect {uuid: '%v'}) DETACH DELETE r", uuid)})
+		qs = append(qs, &neoism.CypherQuery{Statement: fmt.Sprintf("MATCH (a:ConcordanceAudit) WHERE a.canonicalUUID = '%v' OR a.sourceUUID = '%v' DELETE a", uuid, uuid)})
 	}
 
 	err := db.CypherBatch(qs)
@@ -76,3 +79,11 @@ func contains(rels relationships, rel string) bool {
 	}
 	return false
 }
+
+func orgJSON(t *testing.T, o organisation) string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,206 @@
+package organisations
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+var (
+	uuidRegex    = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	leiCodeRegex = regexp.MustCompile(`^[0-9A-Z]{18}[0-9]{2}$`)
+	isinRegex    = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z]{9}[0-9]$`)
+	sedolRegex   = regexp.MustCompile(`^[0-9BCDFGHJKLMNPQRSTVWXYZ]{6}[0-9]$`)
+	cusipRegex   = regexp.MustCompile(`^[0-9A-Z*@#]{8}[0-9]$`)
+	tickerRegex  = regexp.MustCompile(`^[0-9A-Z]{4}:[0-9A-Z][0-9A-Z./-]{0,19}$`)
+)
+
+// marketIdentifierChecks return what is wrong with a market identifier, if anything
+var marketIdentifierChecks = map[string]func(value string) string{
+	isinIdentifierLabel:   checkISIN,
+	sedolIdentifierLabel:  checkSEDOL,
+	cusipIdentifierLabel:  checkCUSIP,
+	tickerIdentifierLabel: checkTicker,
+}
+
+// organisationValidator checks some fields of an organisation, returning a problem for each bad value
+type organisationValidator func(o organisation) []string
+
+// validateOrganisation runs all the validators, returning a requestError listing every problem found.
+// The type must be one of the given ones
+func validateOrganisation(o organisation, types OrgTypes) error {
+	validators := []organisationValidator{
+		validateUUIDs,
+		types.validateType,
+		validateLeiCode,
+		validateMarketIdentifiers,
+	}
+
+	problems := []string{}
+	for _, validator := range validators {
+		problems = append(problems, validator(o)...)
+	}
+
+	if len(problems) > 0 {
+		return requestError{strings.Join(problems, "; ")}
+	}
+	return nil
+}
+
+func validateUUIDs(o organisation) []string {
+	problems := []string{}
+
+	if o.UUID == "" {
+		problems = append(problems, "uuid: is required")
+	} else if !uuidRegex.MatchString(o.UUID) {
+		problems = append(problems, fmt.Sprintf("uuid: '%s' is not a valid uuid", o.UUID))
+	}
+	if o.ParentOrganisation != "" && !uuidRegex.MatchString(o.ParentOrganisation) {
+		problems = append(problems, fmt.Sprintf("parentOrganisation: '%s' is not a valid uuid", o.ParentOrganisation))
+	}
+	if o.IndustryClassification != "" && !uuidRegex.MatchString(o.IndustryClassification) {
+		problems = append(problems, fmt.Sprintf("industryClassification: '%s' is not a valid uuid", o.IndustryClassification))
+	}
+	for _, uuid := range o.AlternativeIdentifiers.UUIDS {
+		if !uuidRegex.MatchString(uuid) {
+			problems = append(problems, fmt.Sprintf("alternativeIdentifiers.uuids: '%s' is not a valid uuid", uuid))
+		}
+	}
+
+	return problems
+}
+
+func validateLeiCode(o organisation) []string {
+	lei := o.AlternativeIdentifiers.LeiCode
+	if lei == "" {
+		return nil
+	}
+
+	if !leiCodeRegex.MatchString(lei) {
+		return []string{fmt.Sprintf("alternativeIdentifiers.leiCode: '%s' should be 18 uppercase letters or digits followed by 2 check digits", lei)}
+	}
+	if !validMod97Checksum(lei) {
+		return []string{fmt.Sprintf("alternativeIdentifiers.leiCode: '%s' has wrong check digits", lei)}
+	}
+	return nil
+}
+
+// validMod97Checksum checks the ISO 7064 MOD 97-10 check digits of an alphanumeric code, with letters counting A=10 to Z=35
+func validMod97Checksum(code string) bool {
+	digits := strings.Builder{}
+	for _, c := range code {
+		if c >= 'A' && c <= 'Z' {
+			digits.WriteString(fmt.Sprintf("%d", c-'A'+10))
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+func validateMarketIdentifiers(o organisation) []string {
+	problems := []string{}
+	for _, market := range marketIdentifiers {
+		check := marketIdentifierChecks[market.label]
+		for _, value := range *market.list(&o.AlternativeIdentifiers) {
+			if problem := check(value); problem != "" {
+				problems = append(problems, fmt.Sprintf("alternativeIdentifiers.%s: '%s' %s", market.field, value, problem))
+			}
+		}
+	}
+	return problems
+}
+
+// checkISIN checks an ISO 6166 ISIN: a country code, 9 letters or digits and a Luhn check digit over all of them,
+// with letters counting A=10 to Z=35
+func checkISIN(isin string) string {
+	if !isinRegex.MatchString(isin) {
+		return "should be a 2 letter country code followed by 9 uppercase letters or digits and a check digit"
+	}
+
+	digits := ""
+	for _, c := range isin {
+		digits += fmt.Sprintf("%d", alphanumericValue(c))
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+		}
+		sum += d/10 + d%10
+	}
+	if sum%10 != 0 {
+		return "has a wrong check digit"
+	}
+	return ""
+}
+
+// checkSEDOL checks a SEDOL: 6 digits or consonants and a check digit, weighting them 1, 3, 1, 7, 3 and 9
+func checkSEDOL(sedol string) string {
+	if !sedolRegex.MatchString(sedol) {
+		return "should be 6 digits or uppercase consonants followed by a check digit"
+	}
+
+	weights := []int{1, 3, 1, 7, 3, 9}
+	sum := 0
+	for i, c := range sedol[:6] {
+		sum += weights[i] * alphanumericValue(c)
+	}
+	if (10-sum%10)%10 != int(sedol[6]-'0') {
+		return "has a wrong check digit"
+	}
+	return ""
+}
+
+// checkCUSIP checks a CUSIP: 8 letters, digits, *, @ or # and a check digit, doubling every second character's value
+func checkCUSIP(cusip string) string {
+	if !cusipRegex.MatchString(cusip) {
+		return "should be 8 uppercase letters, digits, *, @ or # followed by a check digit"
+	}
+
+	sum := 0
+	for i, c := range cusip[:8] {
+		var v int
+		switch c {
+		case '*':
+			v = 36
+		case '@':
+			v = 37
+		case '#':
+			v = 38
+		default:
+			v = alphanumericValue(c)
+		}
+		if i%2 == 1 {
+			v *= 2
+		}
+		sum += v/10 + v%10
+	}
+	if (10-sum%10)%10 != int(cusip[8]-'0') {
+		return "has a wrong check digit"
+	}
+	return ""
+}
+
+// checkTicker checks a ticker is scoped to the ISO 10383 MIC of its exchange, like XNAS:AAPL
+func checkTicker(ticker string) string {
+	if !tickerRegex.MatchString(ticker) {
+		return "should be the 4 character MIC of an exchange and an uppercase symbol, like XNAS:AAPL"
+	}
+	return ""
+}
+
+// alphanumericValue is the value of a digit, or of a letter counting A=10 to Z=35
+func alphanumericValue(c rune) int {
+	if c >= 'A' && c <= 'Z' {
+		return int(c-'A') + 10
+	}
+	return int(c - '0')
+}
@@ -0,0 +1,89 @@
+package organisations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidOrganisation(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateOrganisation(fullOrg, defaultOrgTypes))
+	assert.NoError(validateOrganisation(minimalOrg, defaultOrgTypes))
+}
+
+func TestValidateLeiCode(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, lei := range []string{"549300U1OW41QPKYW028", "5493001KJTIIGC8Y1R12", "7LTWFZYICNSX8D621K86"} {
+		o := minimalOrg
+		o.AlternativeIdentifiers.LeiCode = lei
+		assert.NoError(validateOrganisation(o, defaultOrgTypes), lei)
+	}
+
+	for lei, problem := range map[string]string{
+		"549300U1OW41QPKYW027":   "alternativeIdentifiers.leiCode: '549300U1OW41QPKYW027' has wrong check digits",
+		"549300u1ow41qpkyw028":   "alternativeIdentifiers.leiCode: '549300u1ow41qpkyw028' should be 18 uppercase letters or digits followed by 2 check digits",
+		" 549300U1OW41QPKYW028 ": "alternativeIdentifiers.leiCode: ' 549300U1OW41QPKYW028 ' should be 18 uppercase letters or digits followed by 2 check digits",
+		"549300U1OW41QPKYW0":     "alternativeIdentifiers.leiCode: '549300U1OW41QPKYW0' should be 18 uppercase letters or digits followed by 2 check digits",
+	} {
+		o := minimalOrg
+		o.AlternativeIdentifiers.LeiCode = lei
+		assert.Equal(requestError{problem}, validateOrganisation(o, defaultOrgTypes), lei)
+	}
+}
+
+func TestValidateListsEveryInvalidField(t *testing.T) {
+	assert := assert.New(t)
+
+	o := fullOrg
+	o.UUID = "4E484678-CF47-4168-B844-6ADB47F8EB58"
+	o.ParentOrganisation = "parentOrgUUID"
+	o.IndustryClassification = "not-a-uuid"
+	o.AlternativeIdentifiers.UUIDS = []string{fullOrgUUID, "also-not-a-uuid"}
+	o.AlternativeIdentifiers.LeiCode = "leiCodeIdentifier"
+
+	err := validateOrganisation(o, defaultOrgTypes)
+
+	assert.Equal(requestError{"uuid: '4E484678-CF47-4168-B844-6ADB47F8EB58' is not a valid uuid; " +
+		"parentOrganisation: 'parentOrgUUID' is not a valid uuid; " +
+		"industryClassification: 'not-a-uuid' is not a valid uuid; " +
+		"alternativeIdentifiers.uuids: 'also-not-a-uuid' is not a valid uuid; " +
+		"alternativeIdentifiers.leiCode: 'leiCodeIdentifier' should be 18 uppercase letters or digits followed by 2 check digits"}, err)
+}
+
+func TestValidateRequiresUUIDAndType(t *testing.T) {
+	assert := assert.New(t)
+
+	err := validateOrganisation(organisation{}, defaultOrgTypes)
+
+	assert.Equal(requestError{"uuid: is required; type: '' is not supported, it should be one of Company, Organisation or PublicCompany"}, err)
+}
+
+func TestValidateMarketIdentifiers(t *testing.T) {
+	assert := assert.New(t)
+
+	o := minimalOrg
+	o.AlternativeIdentifiers.ISINs = []string{"US0378331005", "GB0002634946"}
+	o.AlternativeIdentifiers.SEDOLs = []string{"0263494", "B0YBKJ7"}
+	o.AlternativeIdentifiers.CUSIPs = []string{"037833100", "38259P508"}
+	o.AlternativeIdentifiers.Tickers = []string{"XNAS:AAPL", "XNYS:BRK.B"}
+	assert.NoError(validateOrganisation(o, defaultOrgTypes))
+
+	o = minimalOrg
+	o.AlternativeIdentifiers.ISINs = []string{"US0378331006", "us0378331005"}
+	o.AlternativeIdentifiers.SEDOLs = []string{"0263495", "A263494"}
+	o.AlternativeIdentifiers.CUSIPs = []string{"037833101", "03783310"}
+	o.AlternativeIdentifiers.Tickers = []string{"AAPL", "XNAS:"}
+
+	assert.Equal(requestError{"alternativeIdentifiers.isins: 'US0378331006' has a wrong check digit; " +
+		"alternativeIdentifiers.isins: 'us0378331005' should be a 2 letter country code followed by 9 uppercase letters or digits and a check digit; " +
+		"alternativeIdentifiers.sedols: '0263495' has a wrong check digit; " +
+		"alternativeIdentifiers.sedols: 'A263494' should be 6 digits or uppercase consonants followed by a check digit; " +
+		"alternativeIdentifiers.cusips: '037833101' has a wrong check digit; " +
+		"alternativeIdentifiers.cusips: '03783310' should be 8 uppercase letters, digits, *, @ or # followed by a check digit; " +
+		"alternativeIdentifiers.tickers: 'AAPL' should be the 4 character MIC of an exchange and an uppercase symbol, like XNAS:AAPL; " +
+		"alternativeIdentifiers.tickers: 'XNAS:' should be the 4 character MIC of an exchange and an uppercase symbol, like XNAS:AAPL"},
+		validateOrganisation(o, defaultOrgTypes))
+}
@@ -0,0 +1,159 @@
+package transfer
+
+import (
+	"fmt"
+
+	"github.com/jmcvetta/neoism"
+)
+
+// Batch reads what moving the relationships of several source nodes to one destination node needs, in as many queries
+// as for a single node, so they can run in one round trip. The sources are moved in the order given, and relationships
+// between them end up between the destination node and the sources moved later, so they are handled as loops
+type Batch struct {
+	transferer      Transferer
+	destinationUUID string
+	sourceUUIDs     []string
+
+	counts []struct {
+		UUID      string `json:"uuid"`
+		Direction string `json:"direction"`
+		RelationshipCount
+	}
+	loops []struct {
+		UUID string `json:"uuid"`
+		Loop
+	}
+	groups []struct {
+		Type          string `json:"type"`
+		Direction     string `json:"direction"`
+		OtherUUID     string `json:"otherUUID"`
+		Relationships []struct {
+			Edge
+			Owner string `json:"owner"`
+		} `json:"relationships"`
+	}
+}
+
+// NewBatch returns a Batch reading the relationships of the source nodes. Run its queries before reading from it
+func (t Transferer) NewBatch(destinationUUID string, sourceUUIDs []string) *Batch {
+	return &Batch{transferer: t, destinationUUID: destinationUUID, sourceUUIDs: sourceUUIDs}
+}
+
+// Queries returns the queries reading the relationships, which fill the batch when run
+func (b *Batch) Queries() []*neoism.CypherQuery {
+	label := b.transferer.config.Label
+	parameters := map[string]interface{}{
+		"fromUUIDs": b.sourceUUIDs,
+		"endUUIDs":  append([]string{b.destinationUUID}, b.sourceUUIDs...),
+		"outgoing":  Outgoing,
+		"incoming":  Incoming,
+	}
+
+	countsQuery := &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (a:%[1]s)-[r]->() WHERE a.uuid IN {fromUUIDs}
+					RETURN a.uuid as uuid, {outgoing} as direction, type(r) as relationship, count(r) as count
+					UNION ALL
+					MATCH (a:%[1]s)<-[r]-() WHERE a.uuid IN {fromUUIDs}
+					RETURN a.uuid as uuid, {incoming} as direction, type(r) as relationship, count(r) as count`, label),
+		Parameters: parameters,
+		Result:     &b.counts,
+	}
+
+	loopsQuery := &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (s:%[1]s)-[r]->(p:%[1]s)
+					WHERE s.uuid IN {fromUUIDs} AND p.uuid IN {endUUIDs}
+					RETURN s.uuid as uuid, type(r) as type, {outgoing} as direction, p = s as self, count(r) as count
+					UNION ALL
+					MATCH (s:%[1]s)<-[r]-(p:%[1]s)
+					WHERE s.uuid IN {fromUUIDs} AND p.uuid IN {endUUIDs} AND p <> s
+					RETURN s.uuid as uuid, type(r) as type, {incoming} as direction, false as self, count(r) as count`, label),
+		Parameters: parameters,
+		Result:     &b.loops,
+	}
+
+	groupsQuery := &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (s:%[1]s)-[r]->(p)
+					WHERE s.uuid IN {fromUUIDs} AND NOT coalesce(p.uuid IN {endUUIDs}, false)
+					MATCH (n:%[1]s)-[c]->(p)
+					WHERE n.uuid IN {endUUIDs} AND c <> r AND type(c) = type(r)
+					WITH DISTINCT p, type(r) as type
+					MATCH (n:%[1]s)-[c]->(p)
+					WHERE n.uuid IN {endUUIDs} AND type(c) = type
+					RETURN type, {outgoing} as direction, p.uuid as otherUUID,
+						collect({id: id(c), owner: n.uuid, properties: c}) as relationships
+					UNION ALL
+					MATCH (s:%[1]s)<-[r]-(p)
+					WHERE s.uuid IN {fromUUIDs} AND NOT coalesce(p.uuid IN {endUUIDs}, false)
+					MATCH (n:%[1]s)<-[c]-(p)
+					WHERE n.uuid IN {endUUIDs} AND c <> r AND type(c) = type(r)
+					WITH DISTINCT p, type(r) as type
+					MATCH (n:%[1]s)<-[c]-(p)
+					WHERE n.uuid IN {endUUIDs} AND type(c) = type
+					RETURN type, {incoming} as direction, p.uuid as otherUUID,
+						collect({id: id(c), owner: n.uuid, properties: c}) as relationships`, label),
+		Parameters: parameters,
+		Result:     &b.groups,
+	}
+
+	return []*neoism.CypherQuery{countsQuery, loopsQuery, groupsQuery}
+}
+
+// Relationships returns the types and counts of the relationships from and to the source node
+func (b *Batch) Relationships(sourceUUID string) (from []RelationshipCount, to []RelationshipCount) {
+	from, to = []RelationshipCount{}, []RelationshipCount{}
+	for _, count := range b.counts {
+		if count.UUID != sourceUUID {
+			continue
+		}
+		if count.Direction == Outgoing {
+			from = append(from, count.RelationshipCount)
+		} else {
+			to = append(to, count.RelationshipCount)
+		}
+	}
+	return from, to
+}
+
+// Edges returns the relationships of the source node which would become loops or could collapse when moved.
+// The relationships of the sources moved before it are on the destination node by then
+func (b *Batch) Edges(sourceUUID string) Edges {
+	edges := Edges{Loops: []Loop{}, Groups: []EdgeGroup{}, LoopUUIDs: []string{b.destinationUUID}}
+
+	movedBefore := map[string]bool{b.destinationUUID: true}
+	for _, uuid := range b.sourceUUIDs {
+		if uuid == sourceUUID {
+			break
+		}
+		movedBefore[uuid] = true
+	}
+	for _, uuid := range b.sourceUUIDs {
+		if uuid != sourceUUID {
+			edges.LoopUUIDs = append(edges.LoopUUIDs, uuid)
+		}
+	}
+
+	for _, loop := range b.loops {
+		if loop.UUID == sourceUUID {
+			edges.Loops = append(edges.Loops, loop.Loop)
+		}
+	}
+
+	for _, group := range b.groups {
+		edgeGroup := EdgeGroup{Type: group.Type, Direction: group.Direction, OtherUUID: group.OtherUUID, Relationships: []Edge{}}
+		moving := false
+		for _, rel := range group.Relationships {
+			if rel.Owner == sourceUUID {
+				rel.Edge.Moved = true
+				moving = true
+			} else if !movedBefore[rel.Owner] {
+				continue
+			}
+			edgeGroup.Relationships = append(edgeGroup.Relationships, rel.Edge)
+		}
+		if moving && len(edgeGroup.Relationships) > 1 {
+			edges.Groups = append(edges.Groups, edgeGroup)
+		}
+	}
+
+	return edges
+}
@@ -0,0 +1,54 @@
+package transfer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchSplitsResultsBySource(t *testing.T) {
+	assert := assert.New(t)
+
+	batch := New(Config{}).NewBatch("new", []string{"old1", "old2"})
+	queries := batch.Queries()
+	results := []string{
+		`[{"uuid": "old1", "direction": "outgoing", "relationship": "SUB_ORGANISATION_OF", "count": 1},
+		  {"uuid": "old2", "direction": "incoming", "relationship": "MENTIONS", "count": 4},
+		  {"uuid": "old1", "direction": "incoming", "relationship": "MENTIONS", "count": 2}]`,
+		`[{"uuid": "old1", "type": "SUB_ORGANISATION_OF", "direction": "outgoing", "self": false, "count": 1}]`,
+		`[{"type": "MENTIONS", "direction": "incoming", "otherUUID": "content",
+		   "relationships": [{"id": 1, "owner": "new", "properties": {}},
+		                     {"id": 2, "owner": "old1", "properties": {"platformVersion": "v1"}},
+		                     {"id": 3, "owner": "old2", "properties": {"platformVersion": "v2"}}]}]`,
+	}
+	if !assert.Len(queries, len(results)) {
+		return
+	}
+	for i, result := range results {
+		assert.NoError(json.Unmarshal([]byte(result), queries[i].Result))
+	}
+
+	from, to := batch.Relationships("old1")
+	assert.Equal([]RelationshipCount{{RelationshipType: "SUB_ORGANISATION_OF", Count: 1}}, from)
+	assert.Equal([]RelationshipCount{{RelationshipType: "MENTIONS", Count: 2}}, to)
+
+	first := batch.Edges("old1")
+	assert.Equal([]string{"new", "old2"}, first.LoopUUIDs)
+	assert.Equal([]Loop{{Type: "SUB_ORGANISATION_OF", Direction: Outgoing, Count: 1}}, first.Loops)
+	if assert.Len(first.Groups, 1) {
+		assert.Equal([]Edge{
+			{ID: 1, Properties: map[string]interface{}{}},
+			{ID: 2, Moved: true, Properties: map[string]interface{}{"platformVersion": "v1"}},
+		}, first.Groups[0].Relationships, "the relationships of sources moved later should be left out")
+	}
+
+	second := batch.Edges("old2")
+	assert.Equal([]string{"new", "old1"}, second.LoopUUIDs)
+	assert.Empty(second.Loops)
+	if assert.Len(second.Groups, 1) {
+		assert.Len(second.Groups[0].Relationships, 3, "the relationships of sources moved earlier should be on the destination by then")
+		assert.True(second.Groups[0].Relationships[2].Moved)
+		assert.False(second.Groups[0].Relationships[1].Moved)
+	}
+}
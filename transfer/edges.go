@@ -0,0 +1,209 @@
+package transfer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Financial-Times/neo-utils-go/neoutils"
+	"github.com/jmcvetta/neoism"
+)
+
+const (
+	// LoopDropped is the action on a relationship between the source and destination nodes which is deleted
+	LoopDropped = "dropped"
+	// LoopRepointed is the action on a relationship between the source and destination nodes which is kept on the destination node
+	LoopRepointed = "repointed"
+)
+
+// Edges are the relationships of the source node which cannot simply be moved: those with the destination node or with
+// itself, which would become loops, and those which could collapse into another relationship as they are moved.
+// LoopUUIDs are the nodes relationships with which are loops, which is the destination node unless several are moved together
+type Edges struct {
+	Loops     []Loop      `json:"loops"`
+	Groups    []EdgeGroup `json:"groups"`
+	LoopUUIDs []string    `json:"loopUUIDs"`
+}
+
+// Loop is the number of relationships of one type between the source node and the destination node, or another source
+// moved with it, in the direction they point from the source node. Self loops are relationships of the source node with itself
+type Loop struct {
+	Type      string `json:"type"`
+	Direction string `json:"direction"`
+	Self      bool   `json:"self"`
+	Count     int    `json:"count"`
+	Action    string `json:"action,omitempty"`
+}
+
+// EdgeGroup is the relationships of one type and direction between another node and the source or destination node,
+// when one of those from the source node could be merged into another as it is moved
+type EdgeGroup struct {
+	Type          string `json:"type"`
+	Direction     string `json:"direction"`
+	OtherUUID     string `json:"otherUUID"`
+	Relationships []Edge `json:"relationships"`
+}
+
+// Edge is one relationship of an EdgeGroup, which is moved when it is one of the source node
+type Edge struct {
+	ID         int64                  `json:"id"`
+	Moved      bool                   `json:"moved"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Collapse is a relationship which a transfer merges into another one of the destination node, and the properties
+// which are lost because the other one does not have them or has other values for them
+type Collapse struct {
+	Type           string                 `json:"type"`
+	Direction      string                 `json:"direction"`
+	OtherUUID      string                 `json:"otherUUID"`
+	LostProperties map[string]interface{} `json:"lostProperties"`
+}
+
+// ReadEdges reads the relationships of the source node which would become loops or could collapse when moved to the destination node
+func (t Transferer) ReadEdges(cypherRunner neoutils.CypherRunner, destinationUUID string, sourceUUID string) (Edges, error) {
+	batch := t.NewBatch(destinationUUID, []string{sourceUUID})
+	if err := cypherRunner.CypherBatch(batch.Queries()); err != nil {
+		return Edges{}, err
+	}
+	return batch.Edges(sourceUUID), nil
+}
+
+// WithoutLoops takes the loops out of the counts of relationships from and to the source node. A self loop
+// is counted both from and to the node
+func WithoutLoops(from []RelationshipCount, to []RelationshipCount, loops []Loop) ([]RelationshipCount, []RelationshipCount) {
+	subtract := func(rels []RelationshipCount, loop Loop) []RelationshipCount {
+		remaining := []RelationshipCount{}
+		for _, rel := range rels {
+			if rel.RelationshipType == loop.Type {
+				rel.Count -= loop.Count
+			}
+			if rel.Count > 0 {
+				remaining = append(remaining, rel)
+			}
+		}
+		return remaining
+	}
+
+	for _, loop := range loops {
+		if loop.Self || loop.Direction == Outgoing {
+			from = subtract(from, loop)
+		}
+		if loop.Self || loop.Direction == Incoming {
+			to = subtract(to, loop)
+		}
+	}
+	return from, to
+}
+
+// loopQuery drops the relationships of a loop, or re-points them as a relationship of the destination node with itself
+func (t Transferer) loopQuery(fromUUID string, toUUID string, loopUUIDs []string, loop Loop) *neoism.CypherQuery {
+	pattern := fmt.Sprintf("(oldNode:%s {uuid:{fromUUID}})-[oldRel:%s]->(p:%s) WHERE p.uuid IN {loopUUIDs}", t.config.Label, loop.Type, t.config.Label)
+	if loop.Self {
+		pattern = fmt.Sprintf("(oldNode:%s {uuid:{fromUUID}})-[oldRel:%s]->(oldNode)", t.config.Label, loop.Type)
+	} else if loop.Direction == Incoming {
+		pattern = fmt.Sprintf("(oldNode:%s {uuid:{fromUUID}})<-[oldRel:%s]-(p:%s) WHERE p.uuid IN {loopUUIDs}", t.config.Label, loop.Type, t.config.Label)
+	}
+
+	statement := fmt.Sprintf(`MATCH %s
+					DELETE oldRel`, pattern)
+	if loop.Action == LoopRepointed {
+		statement = fmt.Sprintf(`MATCH %s
+					MATCH (newNode:%s {uuid:{toUUID}})
+					MERGE (newNode)-[newRel:%s]->(newNode)
+					ON CREATE SET %s
+					DELETE oldRel`, pattern, t.config.Label, loop.Type, t.onCreate())
+	}
+
+	return &neoism.CypherQuery{
+		Statement: statement,
+		Parameters: map[string]interface{}{
+			"fromUUID":  fromUUID,
+			"toUUID":    toUUID,
+			"loopUUIDs": loopUUIDs,
+		},
+	}
+}
+
+// collapses works out which moved relationships MERGE finds another relationship for, and the properties they lose.
+// The transfer queries move relationships with the most discriminators first, so those are the ones others collapse into
+func (t Transferer) collapses(groups []EdgeGroup) []Collapse {
+	collapsed := []Collapse{}
+	for _, group := range groups {
+		if !t.Moves(group.Type) {
+			continue
+		}
+
+		targets := []map[string]interface{}{}
+		moving := []Edge{}
+		for _, rel := range group.Relationships {
+			if rel.Moved {
+				moving = append(moving, rel)
+			} else {
+				targets = append(targets, rel.Properties)
+			}
+		}
+		sort.SliceStable(moving, func(i, j int) bool {
+			mi, mj := t.discriminatorMask(moving[i].Properties), t.discriminatorMask(moving[j].Properties)
+			if mi != mj {
+				return mi > mj
+			}
+			return moving[i].ID < moving[j].ID
+		})
+
+		for _, rel := range moving {
+			target := t.mergeTarget(rel.Properties, targets)
+			if target == nil {
+				targets = append(targets, rel.Properties)
+				continue
+			}
+			if lost := t.lostProperties(rel.Properties, target); len(lost) > 0 {
+				collapsed = append(collapsed, Collapse{Type: group.Type, Direction: group.Direction, OtherUUID: group.OtherUUID, LostProperties: lost})
+			}
+		}
+	}
+	return collapsed
+}
+
+// discriminatorMask tells which discriminators a relationship has, in the same way as typeQueries
+func (t Transferer) discriminatorMask(properties map[string]interface{}) int {
+	mask := 0
+	for i, discriminator := range t.config.Discriminators {
+		if _, ok := properties[discriminator]; ok {
+			mask |= 1 << uint(i)
+		}
+	}
+	return mask
+}
+
+// mergeTarget returns the first relationship MERGE would match for one with the properties, which is any having
+// the same values for the discriminators it has
+func (t Transferer) mergeTarget(properties map[string]interface{}, targets []map[string]interface{}) map[string]interface{} {
+	for _, target := range targets {
+		matches := true
+		for _, discriminator := range t.config.Discriminators {
+			value, ok := properties[discriminator]
+			if ok && !reflect.DeepEqual(value, target[discriminator]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return target
+		}
+	}
+	return nil
+}
+
+func (t Transferer) lostProperties(properties map[string]interface{}, target map[string]interface{}) map[string]interface{} {
+	lost := map[string]interface{}{}
+	for name, value := range properties {
+		if name == t.config.SourceProperty {
+			continue
+		}
+		if targetValue, ok := target[name]; !ok || !reflect.DeepEqual(value, targetValue) {
+			lost[name] = value
+		}
+	}
+	return lost
+}
@@ -0,0 +1,110 @@
+package transfer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithoutLoops(t *testing.T) {
+	assert := assert.New(t)
+
+	from := []RelationshipCount{{RelationshipType: "SUB_ORGANISATION_OF", Count: 1}, {RelationshipType: "HAS_ROLE", Count: 3}}
+	to := []RelationshipCount{{RelationshipType: "MENTIONS", Count: 7}, {RelationshipType: "HAS_ROLE", Count: 1}}
+	loops := []Loop{
+		{Type: "SUB_ORGANISATION_OF", Direction: Outgoing, Count: 1},
+		{Type: "HAS_ROLE", Direction: Outgoing, Self: true, Count: 1},
+		{Type: "MENTIONS", Direction: Incoming, Count: 2},
+	}
+
+	from, to = WithoutLoops(from, to, loops)
+
+	assert.Equal([]RelationshipCount{{RelationshipType: "HAS_ROLE", Count: 2}}, from)
+	assert.Equal([]RelationshipCount{{RelationshipType: "MENTIONS", Count: 5}}, to)
+}
+
+func TestQueriesDropOrRepointLoops(t *testing.T) {
+	assert := assert.New(t)
+
+	transferer := New(Config{RepointedLoops: []string{"SIMILAR_TO"}, SourceProperty: "concordedFrom"})
+	edges := Edges{Loops: []Loop{
+		{Type: "SUB_ORGANISATION_OF", Direction: Incoming, Count: 1},
+		{Type: "SIMILAR_TO", Direction: Outgoing, Count: 2},
+		{Type: "SIMILAR_TO", Direction: Outgoing, Self: true, Count: 1},
+	}}
+	from := []RelationshipCount{{RelationshipType: "SIMILAR_TO", Count: 3}}
+	to := []RelationshipCount{{RelationshipType: "SUB_ORGANISATION_OF", Count: 1}, {RelationshipType: "SIMILAR_TO", Count: 1}}
+
+	queries, stats := transferer.Queries("new", "old", from, to, edges)
+
+	assert.Empty(stats.Moved, "the relationships between the nodes should not be moved")
+	assert.Equal([]Loop{
+		{Type: "SUB_ORGANISATION_OF", Direction: Incoming, Count: 1, Action: LoopDropped},
+		{Type: "SIMILAR_TO", Direction: Outgoing, Count: 2, Action: LoopRepointed},
+		{Type: "SIMILAR_TO", Direction: Outgoing, Self: true, Count: 1, Action: LoopRepointed},
+	}, stats.Loops)
+
+	if assert.Len(queries, 3) {
+		assert.Contains(queries[0].Statement, "MATCH (oldNode:Thing {uuid:{fromUUID}})<-[oldRel:SUB_ORGANISATION_OF]-(p:Thing) WHERE p.uuid IN {loopUUIDs}")
+		assert.Contains(queries[0].Statement, "DELETE oldRel")
+		assert.NotContains(queries[0].Statement, "MERGE")
+
+		assert.Contains(queries[1].Statement, "MATCH (oldNode:Thing {uuid:{fromUUID}})-[oldRel:SIMILAR_TO]->(p:Thing) WHERE p.uuid IN {loopUUIDs}")
+		assert.Contains(queries[1].Statement, "MERGE (newNode)-[newRel:SIMILAR_TO]->(newNode)")
+		assert.Contains(queries[1].Statement, "ON CREATE SET newRel = oldRel, newRel.concordedFrom = coalesce(oldRel.concordedFrom, {fromUUID})")
+
+		assert.Contains(queries[2].Statement, "MATCH (oldNode:Thing {uuid:{fromUUID}})-[oldRel:SIMILAR_TO]->(oldNode)")
+		assert.Contains(queries[2].Statement, "MERGE (newNode)-[newRel:SIMILAR_TO]->(newNode)")
+	}
+}
+
+func TestCollapsesReportLostProperties(t *testing.T) {
+	assert := assert.New(t)
+
+	transferer := New(Config{Discriminators: []string{"platformVersion"}, SourceProperty: "concordedFrom", Deny: []string{"HAS_ROLE"}})
+	groups := []EdgeGroup{
+		{
+			Type: "MENTIONS", Direction: Incoming, OtherUUID: "content",
+			Relationships: []Edge{
+				{ID: 1, Moved: false, Properties: map[string]interface{}{"platformVersion": "v1", "relevanceScore": 0.9}},
+				{ID: 2, Moved: true, Properties: map[string]interface{}{"platformVersion": "v1", "relevanceScore": 0.5, "concordedFrom": "older"}},
+				{ID: 3, Moved: true, Properties: map[string]interface{}{"platformVersion": "v2", "relevanceScore": 0.7}},
+			},
+		},
+		{
+			Type: "ABOUT", Direction: Incoming, OtherUUID: "other content",
+			Relationships: []Edge{
+				// the one without a platformVersion is moved last, so it collapses into the other moved one
+				{ID: 4, Moved: true, Properties: map[string]interface{}{"confidence": 0.1}},
+				{ID: 5, Moved: true, Properties: map[string]interface{}{"platformVersion": "v2", "confidence": 0.1}},
+			},
+		},
+		{
+			Type: "SIMILAR_TO", Direction: Outgoing, OtherUUID: "org",
+			Relationships: []Edge{
+				{ID: 6, Moved: false, Properties: map[string]interface{}{"score": 1.0}},
+				{ID: 7, Moved: true, Properties: map[string]interface{}{"score": 1.0}},
+			},
+		},
+		{
+			Type: "HAS_ROLE", Direction: Outgoing, OtherUUID: "role",
+			Relationships: []Edge{
+				{ID: 8, Moved: false, Properties: map[string]interface{}{}},
+				{ID: 9, Moved: true, Properties: map[string]interface{}{"since": "2001"}},
+			},
+		},
+	}
+
+	assert.Equal([]Collapse{
+		{Type: "MENTIONS", Direction: Incoming, OtherUUID: "content", LostProperties: map[string]interface{}{"relevanceScore": 0.5}},
+	}, transferer.collapses(groups[:1]))
+
+	assert.Empty(transferer.collapses(groups[1:3]), "relationships collapsing into identical ones lose nothing")
+
+	groups[1].Relationships[0].Properties["confidence"] = 0.2
+	assert.Equal([]Collapse{
+		{Type: "ABOUT", Direction: Incoming, OtherUUID: "other content", LostProperties: map[string]interface{}{"confidence": 0.2}},
+	}, transferer.collapses(groups[1:2]))
+
+	assert.Empty(transferer.collapses(groups[3:]), "relationships which are not moved do not collapse")
+}
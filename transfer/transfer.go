@@ -0,0 +1,242 @@
+// Package transfer moves the relationships of one concept node onto another, as writers do when they concord
+// an old node into the canonical one. It works on any node label, so it can be shared by the writers of every concept type
+package transfer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Financial-Times/neo-utils-go/neoutils"
+	"github.com/jmcvetta/neoism"
+)
+
+const (
+	// Outgoing is the direction of relationships from the source node
+	Outgoing = "outgoing"
+	// Incoming is the direction of relationships to the source node
+	Incoming = "incoming"
+
+	defaultLabel = "Thing"
+)
+
+// Config describes the nodes and relationships a Transferer works on
+type Config struct {
+	// Label matches both the source and destination node by uuid. It defaults to Thing
+	Label string
+	// Discriminators are relationship properties which tell apart relationships of the same type between the same two nodes,
+	// such as platformVersion. A moved relationship only collapses into an existing one which has the same values for all of them
+	Discriminators []string
+	// Allow lists the only relationship types which are moved. When empty, every type not denied is moved
+	Allow []string
+	// Deny lists relationship types which are never moved, and are left on the source node
+	Deny []string
+	// SourceProperty, when set, is a property recording on each moved relationship the uuid of the node it was first moved from
+	SourceProperty string
+	// RepointedLoops lists the relationship types which, between the source and destination nodes, are kept as a relationship
+	// of the destination node with itself. Relationships of other types between the two nodes are dropped
+	RepointedLoops []string
+}
+
+// RelationshipCount is the number of relationships of one type in one direction of a node
+type RelationshipCount struct {
+	RelationshipType string `json:"relationship"`
+	Count            int    `json:"count"`
+}
+
+// Moved is the number of relationships of one type moved, or left, in one direction
+type Moved struct {
+	Type      string `json:"type"`
+	Direction string `json:"direction"`
+	Count     int    `json:"count"`
+}
+
+// Stats tells which relationships a transfer moves, which it leaves on the source node, what it does with those
+// between the source and destination nodes, and which properties are lost by moved relationships collapsing into others
+type Stats struct {
+	Moved     []Moved    `json:"moved"`
+	Skipped   []Moved    `json:"skipped"`
+	Loops     []Loop     `json:"loops"`
+	Collapsed []Collapse `json:"collapsed"`
+}
+
+// Transferer builds the queries moving relationships between nodes
+type Transferer struct {
+	config Config
+}
+
+// New returns a Transferer for the given configuration
+func New(config Config) Transferer {
+	if config.Label == "" {
+		config.Label = defaultLabel
+	}
+	return Transferer{config}
+}
+
+// Read returns the types and counts of the relationships from and to the node with the uuid
+func (t Transferer) Read(cypherRunner neoutils.CypherRunner, uuid string) (from []RelationshipCount, to []RelationshipCount, err error) {
+	from = []RelationshipCount{}
+	readFromQuery := &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (a:%s {uuid:{uuid}})-[r]->(b)
+					RETURN type(r) as relationship, count(r) as count`, t.config.Label),
+		Parameters: map[string]interface{}{
+			"uuid": uuid,
+		},
+		Result: &from,
+	}
+
+	to = []RelationshipCount{}
+	readToQuery := &neoism.CypherQuery{
+		Statement: fmt.Sprintf(`MATCH (a:%s {uuid:{uuid}})<-[r]-(b)
+					RETURN type(r) as relationship, count(r) as count`, t.config.Label),
+		Parameters: map[string]interface{}{
+			"uuid": uuid,
+		},
+		Result: &to,
+	}
+
+	if err := cypherRunner.CypherBatch([]*neoism.CypherQuery{readFromQuery, readToQuery}); err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
+
+// Plan reads the relationships of the source node and returns the queries moving them to the destination node
+func (t Transferer) Plan(cypherRunner neoutils.CypherRunner, destinationUUID string, sourceUUID string) ([]*neoism.CypherQuery, Stats, error) {
+	batch := t.NewBatch(destinationUUID, []string{sourceUUID})
+	if err := cypherRunner.CypherBatch(batch.Queries()); err != nil {
+		return nil, Stats{}, err
+	}
+	from, to := batch.Relationships(sourceUUID)
+	queries, stats := t.Queries(destinationUUID, sourceUUID, from, to, batch.Edges(sourceUUID))
+	return queries, stats, nil
+}
+
+// Transfer moves the relationships of the source node to the destination node in one transaction
+func (t Transferer) Transfer(cypherRunner neoutils.CypherRunner, destinationUUID string, sourceUUID string) (Stats, error) {
+	queries, stats, err := t.Plan(cypherRunner, destinationUUID, sourceUUID)
+	if err != nil {
+		return Stats{}, err
+	}
+	if len(queries) == 0 {
+		return stats, nil
+	}
+	if err := cypherRunner.CypherBatch(queries); err != nil {
+		return Stats{}, err
+	}
+	return stats, nil
+}
+
+// Queries returns the queries moving the given relationships of the source node to the destination node,
+// along with the stats of what they move. The edges are those read for the same two nodes
+func (t Transferer) Queries(destinationUUID string, sourceUUID string, from []RelationshipCount, to []RelationshipCount, edges Edges) ([]*neoism.CypherQuery, Stats) {
+	queries := []*neoism.CypherQuery{}
+	stats := Stats{Moved: []Moved{}, Skipped: []Moved{}, Loops: []Loop{}, Collapsed: []Collapse{}}
+
+	from, to = WithoutLoops(from, to, edges.Loops)
+	loopUUIDs := edges.LoopUUIDs
+	if len(loopUUIDs) == 0 {
+		loopUUIDs = []string{destinationUUID}
+	}
+
+	add := func(rels []RelationshipCount, direction string) {
+		for _, rel := range rels {
+			moved := Moved{Type: rel.RelationshipType, Direction: direction, Count: rel.Count}
+			if !t.Moves(rel.RelationshipType) {
+				stats.Skipped = append(stats.Skipped, moved)
+				continue
+			}
+			stats.Moved = append(stats.Moved, moved)
+			queries = append(queries, t.typeQueries(sourceUUID, destinationUUID, loopUUIDs, rel.RelationshipType, direction)...)
+		}
+	}
+	add(from, Outgoing)
+	add(to, Incoming)
+
+	for _, loop := range edges.Loops {
+		loop.Action = LoopDropped
+		if contains(t.config.RepointedLoops, loop.Type) {
+			loop.Action = LoopRepointed
+		}
+		stats.Loops = append(stats.Loops, loop)
+		queries = append(queries, t.loopQuery(sourceUUID, destinationUUID, loopUUIDs, loop))
+	}
+
+	stats.Collapsed = t.collapses(edges.Groups)
+
+	return queries, stats
+}
+
+// Moves tells whether relationships of the type are moved
+func (t Transferer) Moves(relationshipType string) bool {
+	if contains(t.config.Deny, relationshipType) {
+		return false
+	}
+	return len(t.config.Allow) == 0 || contains(t.config.Allow, relationshipType)
+}
+
+// typeQueries moves the relationships of one type and direction. As MERGE cannot match on a missing property, there is
+// a query for each combination of discriminators a relationship may have, each merging on the ones it has
+func (t Transferer) typeQueries(fromUUID string, toUUID string, loopUUIDs []string, relationshipType string, direction string) []*neoism.CypherQuery {
+	discriminators := t.config.Discriminators
+
+	queries := []*neoism.CypherQuery{}
+	for mask := 1<<uint(len(discriminators)) - 1; mask >= 0; mask-- {
+		conditions := []string{}
+		mergeProps := []string{}
+		for i, discriminator := range discriminators {
+			if mask&(1<<uint(i)) != 0 {
+				conditions = append(conditions, fmt.Sprintf("EXISTS(oldRel.%s)", discriminator))
+				mergeProps = append(mergeProps, fmt.Sprintf("%s:oldRel.%s", discriminator, discriminator))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("NOT EXISTS(oldRel.%s)", discriminator))
+			}
+		}
+
+		// relationships between the nodes are handled as loops
+		conditions = append([]string{"p <> oldNode", "NOT coalesce(p.uuid IN {loopUUIDs}, false)"}, conditions...)
+		props := ""
+		if len(mergeProps) > 0 {
+			props = "{" + strings.Join(mergeProps, ", ") + "}"
+		}
+
+		oldPattern := fmt.Sprintf("(oldNode:%s {uuid:{fromUUID}})-[oldRel:%s]->(p)", t.config.Label, relationshipType)
+		newPattern := fmt.Sprintf("(newNode)-[newRel:%s%s]->(p)", relationshipType, props)
+		if direction == Incoming {
+			oldPattern = fmt.Sprintf("(oldNode:%s {uuid:{fromUUID}})<-[oldRel:%s]-(p)", t.config.Label, relationshipType)
+			newPattern = fmt.Sprintf("(newNode)<-[newRel:%s%s]-(p)", relationshipType, props)
+		}
+
+		queries = append(queries, &neoism.CypherQuery{
+			Statement: fmt.Sprintf(`MATCH %s
+					MATCH (newNode:%s {uuid:{toUUID}})
+					WHERE %s
+					MERGE %s
+					ON CREATE SET %s
+					DELETE oldRel`, oldPattern, t.config.Label, strings.Join(conditions, " AND "), newPattern, t.onCreate()),
+			Parameters: map[string]interface{}{
+				"fromUUID":  fromUUID,
+				"toUUID":    toUUID,
+				"loopUUIDs": loopUUIDs,
+			},
+		})
+	}
+	return queries
+}
+
+// onCreate copies the properties of the old relationship to the one created in its place
+func (t Transferer) onCreate() string {
+	onCreate := "newRel = oldRel"
+	if t.config.SourceProperty != "" {
+		onCreate += fmt.Sprintf(", newRel.%s = coalesce(oldRel.%s, {fromUUID})", t.config.SourceProperty, t.config.SourceProperty)
+	}
+	return onCreate
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
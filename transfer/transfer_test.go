@@ -0,0 +1,72 @@
+package transfer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueriesMergeOnEachCombinationOfDiscriminators(t *testing.T) {
+	assert := assert.New(t)
+
+	transferer := New(Config{Label: "Person", Discriminators: []string{"platformVersion", "lifecycle"}})
+	queries, _ := transferer.Queries("new", "old", []RelationshipCount{{RelationshipType: "HAS_ROLE", Count: 1}}, nil, Edges{})
+
+	if assert.Len(queries, 4) {
+		assert.Contains(queries[0].Statement, "WHERE p <> oldNode AND NOT coalesce(p.uuid IN {loopUUIDs}, false) AND EXISTS(oldRel.platformVersion) AND EXISTS(oldRel.lifecycle)")
+		assert.Contains(queries[0].Statement, "MERGE (newNode)-[newRel:HAS_ROLE{platformVersion:oldRel.platformVersion, lifecycle:oldRel.lifecycle}]->(p)")
+		assert.Contains(queries[1].Statement, "WHERE p <> oldNode AND NOT coalesce(p.uuid IN {loopUUIDs}, false) AND NOT EXISTS(oldRel.platformVersion) AND EXISTS(oldRel.lifecycle)")
+		assert.Contains(queries[1].Statement, "MERGE (newNode)-[newRel:HAS_ROLE{lifecycle:oldRel.lifecycle}]->(p)")
+		assert.Contains(queries[2].Statement, "WHERE p <> oldNode AND NOT coalesce(p.uuid IN {loopUUIDs}, false) AND EXISTS(oldRel.platformVersion) AND NOT EXISTS(oldRel.lifecycle)")
+		assert.Contains(queries[3].Statement, "WHERE p <> oldNode AND NOT coalesce(p.uuid IN {loopUUIDs}, false) AND NOT EXISTS(oldRel.platformVersion) AND NOT EXISTS(oldRel.lifecycle)")
+		assert.Contains(queries[3].Statement, "MERGE (newNode)-[newRel:HAS_ROLE]->(p)")
+	}
+	for _, query := range queries {
+		assert.Contains(query.Statement, "MATCH (oldNode:Person {uuid:{fromUUID}})-[oldRel:HAS_ROLE]->(p)")
+		assert.Contains(query.Statement, "MATCH (newNode:Person {uuid:{toUUID}})")
+		assert.Contains(query.Statement, "ON CREATE SET newRel = oldRel\n")
+		assert.Equal(map[string]interface{}{"fromUUID": "old", "toUUID": "new", "loopUUIDs": []string{"new"}}, query.Parameters)
+	}
+}
+
+func TestQueriesWithoutDiscriminatorsOrLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	queries, _ := New(Config{SourceProperty: "concordedFrom"}).Queries("new", "old", nil, []RelationshipCount{{RelationshipType: "MENTIONS", Count: 3}}, Edges{})
+
+	if assert.Len(queries, 1) {
+		assert.Contains(queries[0].Statement, "MATCH (oldNode:Thing {uuid:{fromUUID}})<-[oldRel:MENTIONS]-(p)")
+		assert.Contains(queries[0].Statement, "WHERE p <> oldNode AND NOT coalesce(p.uuid IN {loopUUIDs}, false)\n")
+		assert.Contains(queries[0].Statement, "MERGE (newNode)<-[newRel:MENTIONS]-(p)")
+		assert.Contains(queries[0].Statement, "ON CREATE SET newRel = oldRel, newRel.concordedFrom = coalesce(oldRel.concordedFrom, {fromUUID})")
+	}
+}
+
+func TestQueriesOnlyMoveAllowedTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	transferer := New(Config{Allow: []string{"MENTIONS", "HAS_ROLE"}, Deny: []string{"HAS_ROLE"}})
+	from := []RelationshipCount{{RelationshipType: "HAS_ROLE", Count: 2}, {RelationshipType: "SUB_ORGANISATION_OF", Count: 1}}
+	to := []RelationshipCount{{RelationshipType: "MENTIONS", Count: 7}}
+
+	queries, stats := transferer.Queries("new", "old", from, to, Edges{})
+
+	assert.Len(queries, 1)
+	assert.Equal(Stats{
+		Moved: []Moved{{Type: "MENTIONS", Direction: Incoming, Count: 7}},
+		Skipped: []Moved{
+			{Type: "HAS_ROLE", Direction: Outgoing, Count: 2},
+			{Type: "SUB_ORGANISATION_OF", Direction: Outgoing, Count: 1},
+		},
+		Loops:     []Loop{},
+		Collapsed: []Collapse{},
+	}, stats)
+}
+
+func TestMovesEverythingNotDeniedWithoutAllowList(t *testing.T) {
+	assert := assert.New(t)
+
+	transferer := New(Config{Deny: []string{"IDENTIFIES"}})
+	assert.True(transferer.Moves("MENTIONS"))
+	assert.False(transferer.Moves("IDENTIFIES"))
+}